@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/config"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/logging"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/options"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/preflight"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// runCheck validates configuration and network reachability, prints a
+// pass/fail report and exits non-zero when any check failed.
+func runCheck(args []string) {
+	fs := newFlagSet("check")
+	fs.Parse(args)
+
+	// Keep the report readable unless a log level was asked for explicitly.
+	// The config file is read first so a LOG_LEVEL set there applies too.
+	logging.SetLog("warn")
+	fileErr := config.LoadFile()
+	if logLevel := options.Get("LOG_LEVEL"); logLevel != "" {
+		logging.SetLog(logLevel)
+	}
+
+	fmt.Printf("Jellyfin Discovery Proxy %s preflight check\n\n", types.Version)
+
+	report := &preflight.Report{}
+	cfg, err := loadCheckConfig(fileErr)
+	if err != nil {
+		report.Fail("Configuration", "%v", err)
+	} else {
+		report.Pass("Configuration", "server %s, proxy %s, bind %s", cfg.ServerURL, cfg.ProxyURL, cfg.BindIP)
+		preflight.Run(cfg, report)
+	}
+
+	for _, result := range report.Results {
+		status := "PASS"
+		if !result.OK {
+			status = "FAIL"
+		}
+		fmt.Printf("[%s] %-32s %s\n", status, result.Name, result.Detail)
+	}
+
+	failed := report.Failed()
+	fmt.Printf("\n%d checks, %d failed\n", len(report.Results), failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// loadCheckConfig loads config the same way serve does, unless reading the
+// configuration file already failed with fileErr
+func loadCheckConfig(fileErr error) (*types.Config, error) {
+	if fileErr != nil {
+		return nil, fileErr
+	}
+	return config.Load()
+}
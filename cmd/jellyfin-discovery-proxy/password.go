@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/auth"
+)
+
+// runHashPassword reads a password from the first line of stdin and prints
+// its bcrypt hash in the form expected by AUTH_USERS. The password is not
+// accepted as an argument so it stays out of shell history and ps output.
+func runHashPassword(args []string) {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: echo 'password' | jellyfin-discovery-proxy hash-password")
+		os.Exit(2)
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintf(os.Stderr, "Failed to read password from stdin: %v\n", err)
+		os.Exit(1)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		fmt.Fprintln(os.Stderr, "Password must not be empty")
+		os.Exit(1)
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to hash password: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(hash)
+}
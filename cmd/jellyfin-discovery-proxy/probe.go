@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/probe"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// runProbe sends a discovery request to each target given on the command
+// line (the broadcast address when none is) and prints every response.
+// It exits non-zero when nothing answered.
+func runProbe(args []string) {
+	fs := flag.NewFlagSet("probe", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 2*time.Second, "How long to wait for responses")
+	jsonOutput := fs.Bool("json", false, "Print the result as JSON")
+	message := fs.String("message", types.DiscoveryMessage, "Discovery message to send")
+	fs.Usage = func() {
+		binary := filepath.Base(os.Args[0])
+		fmt.Fprintf(fs.Output(), "Usage:\n  %s probe [flags] [target ...]\n\n", binary)
+		fmt.Fprintln(fs.Output(), "Targets are \"broadcast\" (255.255.255.255, the default), a directed broadcast")
+		fmt.Fprintf(fs.Output(), "address such as 192.168.1.255, or a host or IP with an optional :port (default %d).\n\n", types.DiscoveryPort)
+		fmt.Fprintln(fs.Output(), "Flags:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	result, err := probe.Run(fs.Args(), *message, *timeout, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Probe failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(result)
+	} else {
+		printProbeResult(result)
+	}
+
+	if len(result.Responses) == 0 {
+		os.Exit(1)
+	}
+}
+
+// printProbeResult writes a human-readable probe report
+func printProbeResult(result *probe.Result) {
+	for _, target := range result.Targets {
+		fmt.Printf("Sent %q to %s\n", result.Message, target)
+	}
+	for _, message := range result.Errors {
+		fmt.Printf("Error: %s\n", message)
+	}
+	fmt.Println()
+
+	for _, response := range result.Responses {
+		fmt.Printf("%s  (%.1f ms)\n", response.From, response.LatencyMs)
+		if response.Parsed == nil {
+			fmt.Printf("  Error:   %s\n", response.Error)
+			fmt.Printf("  Raw:     %s\n\n", response.Raw)
+			continue
+		}
+		fmt.Printf("  Name:    %s\n", response.Parsed.Name)
+		fmt.Printf("  Id:      %s\n", response.Parsed.Id)
+		fmt.Printf("  Address: %s\n", response.Parsed.Address)
+		if response.Parsed.EndpointAddress != nil {
+			fmt.Printf("  Endpoint address: %v\n", response.Parsed.EndpointAddress)
+		}
+		fmt.Println()
+	}
+
+	fmt.Printf("%d response(s) within %v\n", len(result.Responses), time.Duration(result.TimeoutMs*float64(time.Millisecond)))
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/clients"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/config"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/discovery"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/hooks"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/logging"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// reloadLogger tags configuration reload messages with the config component
+var reloadLogger = logging.Component("config")
+
+// proxy tracks the running discovery listener so configuration reloads can
+// swap settings in place and rebind only when the listen address changed.
+type proxy struct {
+	ctx          context.Context
+	store        *config.Store
+	serverCache  *types.ServerInfoCache
+	requestStats *types.RequestStats
+	clients      *types.ClientRegistry
+	identifier   *clients.Identifier
+	listener     *types.ListenerState
+
+	mutex        sync.Mutex
+	conn         *net.UDPConn
+	stopListener context.CancelFunc
+}
+
+// listen starts the listener goroutine on conn. It receives IPv4 discovery
+// requests and emits the primary response plus, when PROXY_URL_IPV6 is set,
+// a second response carrying the v6 URL.
+func (p *proxy) listen(conn *net.UDPConn) {
+	ctx, cancel := context.WithCancel(p.ctx)
+	p.conn = conn
+	p.stopListener = cancel
+
+	reloadLogger.Logf(types.LogDebug, "Starting listener goroutine for %s", conn.LocalAddr())
+	go discovery.ListenLoop(ctx, conn, p.store, p.serverCache, p.requestStats, p.clients, p.identifier, p.listener)
+}
+
+// close stops the listener goroutine and closes its socket
+func (p *proxy) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.stopListener()
+	reloadLogger.Logf(types.LogInfo, "Closing UDP listener: %s", p.conn.LocalAddr())
+	p.conn.Close()
+}
+
+// reload re-reads the configuration file and environment, applies the new
+// snapshot and returns the options that changed. When anything fails the
+// running configuration is left untouched.
+func (p *proxy) reload() ([]string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err := config.LoadFile(); err != nil {
+		reloadLogger.Logf(types.LogError, "Configuration reload failed, keeping current configuration: %v", err)
+		return nil, &config.InvalidError{Err: err}
+	}
+
+	current := p.store.Get()
+	next, err := config.LoadSnapshot()
+	if err != nil {
+		reloadLogger.Logf(types.LogError, "Configuration reload failed, keeping current configuration: %v", err)
+		return nil, &config.InvalidError{Err: err}
+	}
+
+	// Client names live in their own file, so re-read them even when no
+	// option changed
+	if err := p.identifier.Configure(next.ClientNames, next.ReverseDNS); err != nil {
+		reloadLogger.Logf(types.LogError, "Configuration reload failed, keeping current configuration: %v", err)
+		return nil, &config.InvalidError{Err: err}
+	}
+
+	changes := config.Diff(current, next)
+	if len(changes) == 0 {
+		reloadLogger.Logln(types.LogInfo, "Configuration reloaded, nothing changed")
+		return changes, nil
+	}
+
+	// Open the new log outputs and move the socket first so a failure
+	// keeps the current ones
+	if err := logging.SetOutputs(next.LogOutputs); err != nil {
+		p.identifier.Configure(current.ClientNames, current.ReverseDNS)
+		reloadLogger.Logf(types.LogError, "Configuration reload failed, keeping current configuration: %v", err)
+		return nil, err
+	}
+
+	if next.Config.BindIP != current.Config.BindIP {
+		if err := p.rebind(current.Config.BindIP, next.Config.BindIP); err != nil {
+			p.identifier.Configure(current.ClientNames, current.ReverseDNS)
+			logging.SetOutputs(current.LogOutputs)
+			reloadLogger.Logf(types.LogError, "Configuration reload failed, keeping current configuration: %v", err)
+			return nil, fmt.Errorf("failed to rebind discovery listener: %v", err)
+		}
+	}
+
+	// Keep levels changed at runtime unless the configured levels changed
+	if next.LogLevel != current.LogLevel || next.LogLevels != current.LogLevels {
+		logging.ConfigureLevels(next.LogLevel, next.LogLevels)
+	}
+	logging.SetFormat(next.LogFormat)
+	if next.LogDedup != current.LogDedup {
+		logging.SetDedup(next.LogDedup)
+	}
+	if next.HookDispatch != current.HookDispatch {
+		hooks.SetDispatch(next.HookDispatch)
+	}
+	if next.LogBufferSize != current.LogBufferSize {
+		logging.LogBuffer.SetMaxSize(next.LogBufferSize)
+	}
+	p.serverCache.SetDuration(next.CacheDuration)
+	p.clients.SetExpiry(next.ClientExpiry)
+	p.store.Set(next)
+
+	if next.Config.ServerURL != current.Config.ServerURL {
+		reloadLogger.Logln(types.LogInfo, "Jellyfin server URL changed, clearing cached server info")
+		p.serverCache.Set(nil)
+	}
+
+	if httpSettingsChanged(current.Config, next.Config) {
+		reloadLogger.Logln(types.LogWarn, "HTTP server settings (HTTP_ENABLED, HTTP_BIND, HTTP_PORT, TLS_CERT_FILE, TLS_KEY_FILE) take effect after a restart")
+	}
+
+	for _, change := range changes {
+		reloadLogger.Logf(types.LogInfo, "Configuration changed: %s", change)
+	}
+	reloadLogger.Logf(types.LogInfo, "Configuration reloaded, %d option(s) changed", len(changes))
+	return changes, nil
+}
+
+// rebind moves the discovery listener from oldIP to newIP; the caller must
+// hold p.mutex. The old socket is closed first because 0.0.0.0 and a
+// specific interface address cannot share the port; when the new address
+// cannot be bound the old one is bound again.
+func (p *proxy) rebind(oldIP, newIP string) error {
+	previous := p.conn.LocalAddr()
+	p.stopListener()
+	p.conn.Close()
+
+	conn, err := createUDPListener(newIP)
+	if err != nil {
+		restored, restoreErr := createUDPListener(oldIP)
+		if restoreErr != nil {
+			reloadLogger.Logf(types.LogError, "Failed to restore discovery listener on %s, discovery is stopped until a restart: %v", previous, restoreErr)
+			return err
+		}
+		p.listen(restored)
+		return err
+	}
+
+	reloadLogger.Logf(types.LogInfo, "Listen address changed, moved listener from %s to %s", previous, conn.LocalAddr())
+	p.listen(conn)
+	return nil
+}
+
+// httpSettingsChanged reports whether any setting that is only read when
+// the HTTP server starts differs between two configurations. Certificate
+// contents are reloaded by the server itself and are not compared here.
+func httpSettingsChanged(old, new *types.Config) bool {
+	return old.HTTPEnabled != new.HTTPEnabled ||
+		old.HTTPBind != new.HTTPBind ||
+		old.HTTPPort != new.HTTPPort ||
+		old.TLSCertFile != new.TLSCertFile ||
+		old.TLSKeyFile != new.TLSKeyFile
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/cache"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/clients"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/config"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/hooks"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/logging"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/metrics"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/options"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/server"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/stats"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/web"
+)
+
+// runServe runs the discovery proxy until SIGINT/SIGTERM is received,
+// reloading configuration on SIGHUP
+func runServe(args []string) {
+	web.StartTime = time.Now()
+
+	// Parse command-line flags
+	fs := newFlagSet("serve")
+	versionFlag := fs.Bool("version", false, "Print version and exit")
+	fs.Parse(args)
+
+	if *versionFlag {
+		fmt.Println(types.Version)
+		os.Exit(0)
+	}
+
+	// Read the configuration file before anything else consults options
+	if err := config.LoadFile(); err != nil {
+		logging.Logf(types.LogError, "Configuration error: %v", err)
+		os.Exit(1)
+	}
+
+	// Initialize log buffer
+	logging.LogBuffer = logging.NewLogBuffer(logging.GetLogBufferSize())
+
+	// Set log level and format from flag, environment or configuration file
+	logging.ConfigureLevels(config.LogLevel(), options.Get("LOG_LEVELS"))
+	logging.SetFormat(options.Get("LOG_FORMAT"))
+	if err := logging.SetOutputs(logging.GetOutputConfig()); err != nil {
+		logging.Logf(types.LogError, "Configuration error: %v", err)
+		os.Exit(1)
+	}
+	logging.SetDedup(logging.GetDedupConfig())
+
+	// Initialize request stats
+	requestStats := stats.New()
+
+	logging.Logln(types.LogInfo, "=== Jellyfin Discovery Proxy Starting ===")
+	logging.Logf(types.LogInfo, "Version: %s", types.Version)
+	logging.Logf(types.LogDebug, "Log level set to: %s", logging.Level().Name())
+
+	// Load configuration, blacklist, hooks and cache duration
+	snapshot, err := config.LoadSnapshot()
+	if err != nil {
+		logging.Logf(types.LogError, "Configuration error: %v", err)
+		os.Exit(1)
+	}
+	store := config.NewStore(snapshot)
+	hooks.SetDispatch(snapshot.HookDispatch)
+	cfg := snapshot.Config
+	cacheDuration := snapshot.CacheDuration
+
+	// Create the UDP listener (IPv4 only — Jellyfin discovery is an IPv4 broadcast).
+	conn, err := createUDPListener(cfg.BindIP)
+	if err != nil {
+		logging.Logf(types.LogError, "Failed to create UDP listener: %v", err)
+		os.Exit(1)
+	}
+
+	if cacheDuration == 0 {
+		logging.Logln(types.LogInfo, "Server info will be cached until restart")
+	} else {
+		logging.Logf(types.LogInfo, "Server info will be cached for %v", cacheDuration)
+	}
+	logging.Logf(types.LogDebug, "Cache duration in nanoseconds: %d", cacheDuration.Nanoseconds())
+
+	// Initialize cache
+	serverCache := cache.New(cacheDuration)
+	logging.Logf(types.LogDebug, "Initialized server info cache with duration: %v", cacheDuration)
+
+	// Fetch initial server info
+	fetchInitialServerInfo(cfg.ServerURL, serverCache)
+
+	// Register metrics that are computed at scrape time
+	registerMetrics(serverCache)
+
+	// Set up graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Track clients, expiring idle ones in the background
+	clientRegistry := clients.New(snapshot.ClientExpiry)
+	go clients.PruneLoop(ctx, clientRegistry)
+
+	// Identify clients by MAC address, reverse DNS and friendly name
+	identifier := clients.NewIdentifier()
+	if err := identifier.Configure(snapshot.ClientNames, snapshot.ReverseDNS); err != nil {
+		logging.Logf(types.LogError, "Configuration error: %v", err)
+		os.Exit(1)
+	}
+
+	p := &proxy{
+		ctx:          ctx,
+		store:        store,
+		serverCache:  serverCache,
+		requestStats: requestStats,
+		clients:      clientRegistry,
+		identifier:   identifier,
+		listener:     &types.ListenerState{},
+	}
+
+	// Start HTTP server unless disabled
+	var httpServer *http.Server
+	if cfg.HTTPEnabled {
+		httpServer, err = startHTTPServer(serverCache, store, requestStats, clientRegistry, identifier, p.listener, p.reload)
+		if err != nil {
+			logging.Logf(types.LogError, "Failed to start HTTP server: %v", err)
+			os.Exit(1)
+		}
+	} else {
+		logging.Logln(types.LogInfo, "HTTP server disabled; dashboard, API and metrics are unavailable")
+	}
+
+	logging.Logln(types.LogInfo, "=== Jellyfin Discovery Proxy Ready ===")
+
+	// Set up signal handling
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	if len(levelSignals) > 0 {
+		// Notify with no signals would relay every signal
+		signal.Notify(sigChan, levelSignals...)
+	}
+
+	// Start the listener
+	p.listen(conn)
+
+	logging.Logln(types.LogDebug, "Main thread waiting for shutdown signal")
+
+	// Wait for shutdown signal, reloading configuration on SIGHUP and
+	// changing log levels on SIGUSR1/SIGUSR2
+	for sig := range sigChan {
+		if sig == syscall.SIGHUP {
+			logging.Logln(types.LogInfo, "Received SIGHUP, reloading configuration")
+			p.reload()
+			continue
+		}
+		if handleLevelSignal(sig) {
+			continue
+		}
+		logging.Logf(types.LogInfo, "Received signal %v, initiating graceful shutdown", sig)
+		break
+	}
+
+	// Perform graceful shutdown
+	gracefulShutdown(cancel, httpServer, p)
+
+	logging.Logln(types.LogInfo, "=== Jellyfin Discovery Proxy Stopped ===")
+	os.Exit(0)
+}
+
+// createUDPListener creates the IPv4 UDP listener for Jellyfin discovery.
+// Jellyfin clients broadcast on 255.255.255.255:7359, which is IPv4-only —
+// IPv6 has no broadcast equivalent, so a v6 socket would never receive a
+// real discovery request.
+func createUDPListener(bindIP string) (*net.UDPConn, error) {
+	udp4Addr := fmt.Sprintf("%s:%d", bindIP, types.DiscoveryPort)
+	logging.Logf(types.LogDebug, "Attempting to bind UDP4 listener on %s", udp4Addr)
+	addr4, err := net.ResolveUDPAddr("udp4", udp4Addr)
+	if err != nil {
+		logging.Logf(types.LogError, "Error resolving UDP4 address: %v", err)
+		logging.Logf(types.LogDebug, "UDP4 resolution failed with error type: %T", err)
+		return nil, fmt.Errorf("failed to resolve UDP4 address: %v", err)
+	}
+
+	conn4, err := net.ListenUDP("udp4", addr4)
+	if err != nil {
+		logging.Logf(types.LogError, "Error listening on UDP4 port %d: %v", types.DiscoveryPort, err)
+		logging.Logf(types.LogDebug, "UDP4 bind failed with error type: %T", err)
+		return nil, fmt.Errorf("failed to bind UDP4: %v", err)
+	}
+
+	logging.Logf(types.LogInfo, "Successfully bound to UDP4 %s for discovery requests", udp4Addr)
+	logging.Logf(types.LogDebug, "UDP4 connection local address: %s", conn4.LocalAddr())
+	return conn4, nil
+}
+
+// fetchInitialServerInfo fetches server info at startup so the first
+// discovery request doesn't pay the full HTTP roundtrip.
+func fetchInitialServerInfo(serverURL string, serverCache *types.ServerInfoCache) {
+	logging.Logf(types.LogDebug, "Attempting initial server info fetch from %s", serverURL)
+	serverInfo, err := server.FetchInfo(serverURL)
+	if err != nil {
+		logging.Logf(types.LogWarn, "Could not fetch server info at startup: %v", err)
+		logging.Logln(types.LogWarn, "Will try again when discovery requests are received")
+		logging.Logf(types.LogDebug, "Startup fetch failed with error type: %T", err)
+		return
+	}
+	logging.Logf(types.LogInfo, "Successfully fetched server info - ID: %s, Name: %s", serverInfo.Id, serverInfo.ServerName)
+	serverCache.Set(serverInfo)
+	logging.Logf(types.LogDebug, "Server info cached at: %v", serverCache.Timestamp)
+}
+
+// registerMetrics sets build info and registers gauges that read live state
+func registerMetrics(serverCache *types.ServerInfoCache) {
+	metrics.BuildInfo.Set(1, types.Version, runtime.Version())
+	metrics.NewGaugeFunc("jdp_cache_age_seconds", "Age of the cached server info; absent while the cache is empty.", func() (float64, bool) {
+		age, ok := serverCache.Age()
+		return age.Seconds(), ok
+	})
+	metrics.NewGaugeFunc("jdp_start_time_seconds", "Unix time the proxy started.", func() (float64, bool) {
+		return float64(web.StartTime.Unix()), true
+	})
+}
+
+// startHTTPServer starts the HTTP server for the dashboard, serving HTTPS
+// when a TLS certificate is configured
+func startHTTPServer(serverCache *types.ServerInfoCache, store *config.Store, requestStats *types.RequestStats, clientRegistry *types.ClientRegistry, identifier *clients.Identifier, listenerState *types.ListenerState, reload func() ([]string, error)) (*http.Server, error) {
+	cfg := store.Get().Config
+	httpServer := &http.Server{
+		Handler: web.ProxyHeaders(store, web.LogRequests(web.BasePath(store, web.RequireAuth(store, http.DefaultServeMux)))),
+	}
+	if cfg.TLSCertFile != "" {
+		certReloader, err := web.NewCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		httpServer.TLSConfig = certReloader.TLSConfig()
+	}
+
+	listener, err := web.Listen(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Shutdown waits for open handlers, so end log streams when it starts
+	streamsDone := make(chan struct{})
+	httpServer.RegisterOnShutdown(func() { close(streamsDone) })
+
+	http.HandleFunc("/health", web.HealthCheckHandler)
+	http.HandleFunc("/livez", web.HealthCheckHandler)
+	http.HandleFunc("/readyz", web.ReadinessHandler(listenerState, serverCache))
+	http.HandleFunc("/", web.DashboardHandler(types.Version))
+	http.HandleFunc("/static/", web.StaticFileHandler)
+	http.HandleFunc("/favicon.ico", web.FaviconHandler)
+	http.HandleFunc("/metrics", web.MetricsHandler)
+	http.HandleFunc("/api/v1/status", web.StatusHandler(serverCache, store, requestStats, types.Version))
+	http.HandleFunc("/api/v1/server", web.ServerHandler(serverCache))
+	http.HandleFunc("/api/v1/stats", web.StatsHandler(requestStats))
+	http.HandleFunc("/api/v1/stats/timeseries", web.TimeSeriesHandler(requestStats))
+	http.HandleFunc("/api/v1/logs", web.LogsHandler(logging.LogBuffer))
+	http.HandleFunc("/api/v1/logs/stream", web.LogStreamHandler(logging.LogBuffer, streamsDone))
+	http.HandleFunc("/api/v1/clients", web.ClientsHandler(clientRegistry, identifier))
+	http.HandleFunc("/api/v1/clients/names", web.ClientNamesHandler(identifier))
+	http.HandleFunc("/api/v1/hooks", web.HooksHandler(store))
+	http.HandleFunc("/api/v1/admin/reload", web.ReloadHandler(reload))
+	http.HandleFunc("/api/v1/admin/log-levels", web.LogLevelsHandler())
+	http.HandleFunc("/api/v1/admin/cache/invalidate", web.CacheInvalidateHandler(serverCache))
+	http.HandleFunc("/api/v1/admin/cache/refresh", web.CacheRefreshHandler(serverCache, store))
+	http.HandleFunc("/api/v1/admin/discovery-test", web.DiscoveryTestHandler(store))
+	http.HandleFunc("/api/v1/admin/hooks/dead-letters", web.DeadLettersHandler())
+	http.HandleFunc("/api/v1/admin/hooks/dead-letters/replay", web.DeadLetterReplayHandler(store))
+
+	go func() {
+		baseURL := web.DisplayURL(cfg)
+		logging.Logf(types.LogInfo, "Starting HTTP server on %s", listener.Addr())
+		logging.Logf(types.LogInfo, "Dashboard available at %s", baseURL)
+		logging.Logf(types.LogInfo, "Health checks available at %s/livez and %s/readyz", baseURL, baseURL)
+		logging.Logf(types.LogInfo, "Prometheus metrics available at %s/metrics", baseURL)
+		var err error
+		if httpServer.TLSConfig != nil {
+			err = httpServer.ServeTLS(listener, "", "")
+		} else {
+			err = httpServer.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			logging.Logf(types.LogError, "HTTP server error: %v", err)
+		}
+	}()
+
+	return httpServer, nil
+}
+
+// gracefulShutdown performs graceful shutdown of all services
+func gracefulShutdown(cancel context.CancelFunc, httpServer *http.Server, p *proxy) {
+	// Cancel context to signal goroutines to stop
+	cancel()
+
+	// Shutdown HTTP server
+	if httpServer != nil {
+		logging.Logln(types.LogInfo, "Shutting down HTTP server")
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer shutdownCancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			logging.Logf(types.LogWarn, "HTTP server shutdown error: %v", err)
+		}
+	}
+
+	// Close UDP connection
+	p.close()
+
+	// Let queued hooks finish now that no new requests arrive
+	hooks.Drain()
+
+	// Give goroutines a moment to finish
+	time.Sleep(100 * time.Millisecond)
+}
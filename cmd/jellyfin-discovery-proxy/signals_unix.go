@@ -0,0 +1,27 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/logging"
+)
+
+// levelSignals change log levels at runtime: SIGUSR1 cycles the global
+// level one step more verbose, SIGUSR2 restores the configured levels
+var levelSignals = []os.Signal{syscall.SIGUSR1, syscall.SIGUSR2}
+
+// handleLevelSignal applies a log level signal, reporting whether sig was one
+func handleLevelSignal(sig os.Signal) bool {
+	switch sig {
+	case syscall.SIGUSR1:
+		logging.CycleLevel()
+	case syscall.SIGUSR2:
+		logging.ResetLevels()
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// levelSignals is empty on Windows, which has no SIGUSR1/SIGUSR2; log
+// levels can still be changed through the admin API
+var levelSignals []os.Signal
+
+// handleLevelSignal never handles a signal on Windows
+func handleLevelSignal(sig os.Signal) bool {
+	return false
+}
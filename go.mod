@@ -1,3 +1,5 @@
 module github.com/jpkribs/jellyfin-discovery-proxy
 
 go 1.19
+
+require golang.org/x/crypto v0.21.0
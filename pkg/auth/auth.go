@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/logging"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/options"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// verifiedTTL is how long a successful password check is remembered, so
+// the dashboard's API calls do not each pay for a bcrypt comparison
+const verifiedTTL = 5 * time.Minute
+
+// csrfSecret keys the CSRF tokens handed to dashboard sessions. It is
+// random per process, so tokens stop working after a restart and the
+// dashboard simply reloads them with the page.
+var csrfSecret = make([]byte, 32)
+
+func init() {
+	if _, err := rand.Read(csrfSecret); err != nil {
+		panic(fmt.Sprintf("failed to generate CSRF secret: %v", err))
+	}
+}
+
+// logger tags this package's log records with the auth component
+var logger = logging.Component("auth")
+
+// Config holds the dashboard users and API tokens. Authentication is
+// enabled when either is configured.
+type Config struct {
+	Users    map[string][]byte
+	Tokens   [][32]byte
+	verified map[[32]byte]time.Time
+	// dummyHash is compared against when the user does not exist. It has
+	// the highest cost of the configured hashes, so unknown and known users
+	// take the same time to reject.
+	dummyHash []byte
+	mutex     sync.Mutex
+}
+
+// Load reads AUTH_USERS (comma-separated user:bcrypt-hash entries) and
+// AUTH_API_TOKENS (comma-separated bearer tokens)
+func Load() (*Config, error) {
+	cfg := &Config{
+		Users:    make(map[string][]byte),
+		verified: make(map[[32]byte]time.Time),
+	}
+
+	for _, entry := range strings.Split(options.Get("AUTH_USERS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		user, hash, found := strings.Cut(entry, ":")
+		if !found || user == "" {
+			return nil, fmt.Errorf("invalid AUTH_USERS entry for '%s': expected user:bcrypt-hash", user)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("invalid bcrypt hash for AUTH_USERS user '%s': %v", user, err)
+		}
+		cfg.Users[user] = []byte(hash)
+	}
+
+	for _, token := range strings.Split(options.Get("AUTH_API_TOKENS"), ",") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		cfg.Tokens = append(cfg.Tokens, sha256.Sum256([]byte(token)))
+	}
+
+	cost := bcrypt.MinCost
+	for _, hash := range cfg.Users {
+		if hashCost, _ := bcrypt.Cost(hash); hashCost > cost {
+			cost = hashCost
+		}
+	}
+	if len(cfg.Users) > 0 {
+		dummyHash, err := bcrypt.GenerateFromPassword([]byte("jellyfin-discovery-proxy"), cost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare password checks: %v", err)
+		}
+		cfg.dummyHash = dummyHash
+	}
+
+	if cfg.Enabled() {
+		logger.Logf(types.LogInfo, "Dashboard authentication enabled with %d user(s) and %d API token(s)", len(cfg.Users), len(cfg.Tokens))
+	}
+	return cfg, nil
+}
+
+// Enabled reports whether any users or tokens are configured
+func (c *Config) Enabled() bool {
+	return len(c.Users) > 0 || len(c.Tokens) > 0
+}
+
+// CheckPassword verifies a basic auth user and password
+func (c *Config) CheckPassword(user, password string) bool {
+	key := sha256.Sum256([]byte(user + "\x00" + password))
+
+	c.mutex.Lock()
+	verifiedAt, ok := c.verified[key]
+	c.mutex.Unlock()
+	if ok && time.Since(verifiedAt) < verifiedTTL {
+		return true
+	}
+
+	hash, known := c.Users[user]
+	if !known {
+		bcrypt.CompareHashAndPassword(c.dummyHash, []byte(password))
+		return false
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for k, at := range c.verified {
+		if time.Since(at) >= verifiedTTL {
+			delete(c.verified, k)
+		}
+	}
+	c.verified[key] = time.Now()
+	return true
+}
+
+// CheckToken verifies a bearer token
+func (c *Config) CheckToken(token string) bool {
+	sum := sha256.Sum256([]byte(token))
+	match := 0
+	for _, candidate := range c.Tokens {
+		match |= subtle.ConstantTimeCompare(sum[:], candidate[:])
+	}
+	return match == 1
+}
+
+// CSRFToken returns the token a dashboard session for user must send with
+// state-changing requests
+func CSRFToken(user string) string {
+	mac := hmac.New(sha256.New, csrfSecret)
+	mac.Write([]byte(user))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CheckCSRF verifies a CSRF token sent by user
+func CheckCSRF(user, token string) bool {
+	return hmac.Equal([]byte(CSRFToken(user)), []byte(token))
+}
+
+// HashPassword returns the bcrypt hash of password for use in AUTH_USERS
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %v", err)
+	}
+	return string(hash), nil
+}
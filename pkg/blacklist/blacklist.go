@@ -8,6 +8,9 @@ import (
 	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
 )
 
+// logger tags this package's log records with the config component
+var logger = logging.Component("config")
+
 // New creates a new IP blacklist from comma-separated string
 // Supports both individual IPs (192.168.1.100) and CIDR notation (192.168.1.0/24)
 func New(blacklistStr string) *types.IPBlacklist {
@@ -31,22 +34,64 @@ func New(blacklistStr string) *types.IPBlacklist {
 		if strings.Contains(entry, "/") {
 			_, ipnet, err := net.ParseCIDR(entry)
 			if err != nil {
-				logging.Logf(types.LogWarn, "Invalid CIDR notation in blacklist: %s, skipping", entry)
+				logger.Logf(types.LogWarn, "Invalid CIDR notation in blacklist: %s, skipping", entry)
 				continue
 			}
 			bl.Subnets = append(bl.Subnets, ipnet)
-			logging.Logf(types.LogDebug, "Added subnet to blacklist: %s", entry)
+			logger.Logf(types.LogDebug, "Added subnet to blacklist: %s", entry)
 		} else {
 			// Individual IP address
 			parsedIP := net.ParseIP(entry)
 			if parsedIP == nil {
-				logging.Logf(types.LogWarn, "Invalid IP address in blacklist: %s, skipping", entry)
+				logger.Logf(types.LogWarn, "Invalid IP address in blacklist: %s, skipping", entry)
 				continue
 			}
 			bl.IPs[entry] = true
-			logging.Logf(types.LogDebug, "Added IP to blacklist: %s", entry)
+			logger.Logf(types.LogDebug, "Added IP to blacklist: %s", entry)
 		}
 	}
 
 	return bl
 }
+
+// NewMACFilter creates a MAC filter from comma-separated allow and deny
+// lists. unresolved selects what happens to clients whose MAC address
+// cannot be resolved: "allow" (fail open) or "deny" (fail closed).
+func NewMACFilter(allowStr, denyStr, unresolved string) *types.MACFilter {
+	mf := &types.MACFilter{
+		Allow:           parseMACs(allowStr, "allowlist"),
+		Deny:            parseMACs(denyStr, "denylist"),
+		AllowUnresolved: true,
+	}
+
+	switch strings.ToLower(strings.TrimSpace(unresolved)) {
+	case "", "allow":
+	case "deny":
+		mf.AllowUnresolved = false
+	default:
+		logger.Logf(types.LogWarn, "Invalid MAC_UNRESOLVED value: %s, allowing clients with unknown MAC addresses", unresolved)
+	}
+
+	return mf
+}
+
+// parseMACs parses a comma-separated list of MAC addresses into a set keyed
+// by the lowercase colon-separated form used by the neighbor table
+func parseMACs(macStr, listName string) map[string]bool {
+	macs := make(map[string]bool)
+	for _, entry := range strings.Split(macStr, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		hw, err := net.ParseMAC(entry)
+		if err != nil {
+			logger.Logf(types.LogWarn, "Invalid MAC address in %s: %s, skipping", listName, entry)
+			continue
+		}
+		macs[hw.String()] = true
+		logger.Logf(types.LogDebug, "Added MAC to %s: %s", listName, hw.String())
+	}
+	return macs
+}
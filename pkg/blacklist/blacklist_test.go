@@ -0,0 +1,43 @@
+package blacklist
+
+import "testing"
+
+func TestMACFilterEvaluate(t *testing.T) {
+	const (
+		tv     = "aa:bb:cc:dd:ee:01"
+		laptop = "aa:bb:cc:dd:ee:02"
+		other  = "aa:bb:cc:dd:ee:03"
+	)
+
+	tests := []struct {
+		name         string
+		allow        string
+		deny         string
+		unresolved   string
+		mac          string
+		wantAllowed  bool
+		wantResolved bool
+	}{
+		{"no rules", "", "", "", other, true, true},
+		{"no rules, unresolved", "", "", "deny", "", true, true},
+		{"allowlisted", tv, "", "", tv, true, true},
+		{"not allowlisted", tv, "", "", other, false, true},
+		{"denylisted", "", tv, "", tv, false, true},
+		{"not denylisted", "", tv, "", other, true, true},
+		{"deny wins over allow", tv + "," + laptop, tv, "", tv, false, true},
+		{"rules normalize case and separators", "AA-BB-CC-DD-EE-01", "", "", tv, true, true},
+		{"unresolved allowed by default", tv, "", "", "", true, false},
+		{"unresolved denied", tv, "", "deny", "", false, false},
+		{"invalid unresolved mode allows", tv, "", "maybe", "", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewMACFilter(tt.allow, tt.deny, tt.unresolved)
+			allowed, resolved := filter.Evaluate(tt.mac)
+			if allowed != tt.wantAllowed || resolved != tt.wantResolved {
+				t.Errorf("Evaluate(%q) = (%v, %v), want (%v, %v)", tt.mac, allowed, resolved, tt.wantAllowed, tt.wantResolved)
+			}
+		})
+	}
+}
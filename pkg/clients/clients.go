@@ -0,0 +1,69 @@
+package clients
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/logging"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/options"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// logger tags this package's log records with the discovery component
+var logger = logging.Component("discovery")
+
+// pruneInterval is how often idle clients are checked for expiry
+const pruneInterval = time.Minute
+
+// New creates a new empty ClientRegistry with the given idle expiry
+func New(expiry time.Duration) *types.ClientRegistry {
+	return &types.ClientRegistry{
+		Clients: make(map[string]*types.ClientInfo),
+		Expiry:  expiry,
+	}
+}
+
+// GetExpiry parses the CLIENT_EXPIRY option (hours) and returns how long
+// idle clients are kept
+func GetExpiry() time.Duration {
+	hours := options.Int("CLIENT_EXPIRY", 24)
+	if hours == 0 {
+		logger.Logln(types.LogDebug, "CLIENT_EXPIRY set to 0, keeping clients until restart")
+	} else {
+		logger.Logf(types.LogDebug, "Idle clients expire after %d hours", hours)
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// PruneLoop removes idle clients from the registry until ctx is cancelled
+func PruneLoop(ctx context.Context, registry *types.ClientRegistry) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if removed := registry.Prune(); removed > 0 {
+				logger.Logf(types.LogDebug, "Expired %d idle client(s)", removed)
+			}
+		}
+	}
+}
+
+// ReverseDNSEnabled parses the CLIENT_REVERSE_DNS option
+func ReverseDNSEnabled() bool {
+	valueStr := options.Get("CLIENT_REVERSE_DNS")
+	if valueStr == "" {
+		return false
+	}
+
+	enabled, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		logger.Logf(types.LogWarn, "Invalid CLIENT_REVERSE_DNS value: %s, reverse DNS disabled", valueStr)
+		return false
+	}
+	return enabled
+}
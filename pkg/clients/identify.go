@@ -0,0 +1,248 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/neighbors"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// Reverse DNS results are cached so the request path never waits on DNS.
+// At most maxHostnames addresses are cached or being looked up, so packets
+// from many (possibly spoofed) sources cannot grow the cache without bound.
+const (
+	reverseDNSTimeout = 2 * time.Second
+	reverseDNSTTL     = time.Hour
+	maxHostnames      = 4096
+)
+
+// hostnameEntry is a cached reverse DNS result
+type hostnameEntry struct {
+	hostname   string
+	resolvedAt time.Time
+}
+
+// Identifier enriches client IPs with the MAC address from the neighbor
+// table, an optional reverse DNS name and a user-editable friendly name.
+// Friendly names are keyed by MAC address or IP; a MAC entry wins so a
+// device keeps its name when DHCP hands it a new address.
+type Identifier struct {
+	names      map[string]string
+	namesFile  string
+	reverseDNS bool
+	hostnames  map[string]hostnameEntry
+	pending    map[string]bool
+	mutex      sync.RWMutex
+}
+
+// NewIdentifier creates an Identifier with no names and reverse DNS disabled
+func NewIdentifier() *Identifier {
+	return &Identifier{
+		names:     make(map[string]string),
+		hostnames: make(map[string]hostnameEntry),
+		pending:   make(map[string]bool),
+	}
+}
+
+// Configure sets the friendly-name file and reverse DNS option, loading the
+// names from the file when one is given
+func (id *Identifier) Configure(namesFile string, reverseDNS bool) error {
+	names := make(map[string]string)
+	if namesFile != "" {
+		data, err := os.ReadFile(namesFile)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read client names file '%s': %v", namesFile, err)
+		}
+		if len(data) > 0 {
+			var loaded map[string]string
+			if err := json.Unmarshal(data, &loaded); err != nil {
+				return fmt.Errorf("failed to parse client names file '%s': %v", namesFile, err)
+			}
+			for key, name := range loaded {
+				names[normalizeKey(key)] = name
+			}
+		}
+		logger.Logf(types.LogInfo, "Loaded %d client name(s) from %s", len(names), namesFile)
+	}
+
+	id.mutex.Lock()
+	defer id.mutex.Unlock()
+
+	id.names = names
+	id.namesFile = namesFile
+	id.reverseDNS = reverseDNS
+	return nil
+}
+
+// Identify returns everything known about ip. Reverse DNS lookups run in
+// the background; the hostname appears once the lookup has completed.
+func (id *Identifier) Identify(ip string) types.ClientIdentity {
+	identity := types.ClientIdentity{
+		IP:  ip,
+		MAC: neighbors.Lookup(ip),
+	}
+
+	id.mutex.Lock()
+	defer id.mutex.Unlock()
+
+	identity.Name = id.nameFor(ip, identity.MAC)
+
+	if id.reverseDNS {
+		entry, ok := id.hostnames[ip]
+		identity.Hostname = entry.hostname
+		if (!ok || time.Since(entry.resolvedAt) > reverseDNSTTL) && !id.pending[ip] && id.reserveHostname(ip) {
+			id.pending[ip] = true
+			go id.resolve(ip)
+		}
+	}
+	return identity
+}
+
+// reserveHostname reports whether a lookup for ip may start, evicting
+// expired cache entries when the cache is full; the caller must hold the
+// mutex
+func (id *Identifier) reserveHostname(ip string) bool {
+	if _, ok := id.hostnames[ip]; ok || len(id.hostnames)+len(id.pending) < maxHostnames {
+		return true
+	}
+
+	for cached, entry := range id.hostnames {
+		if time.Since(entry.resolvedAt) > reverseDNSTTL {
+			delete(id.hostnames, cached)
+		}
+	}
+	if len(id.hostnames)+len(id.pending) < maxHostnames {
+		return true
+	}
+	logger.Logf(types.LogDebug, "Reverse DNS cache full, not looking up %s", ip)
+	return false
+}
+
+// NameFor returns the friendly name for a client, preferring a name
+// assigned to its MAC address over one assigned to its IP
+func (id *Identifier) NameFor(ip, mac string) string {
+	id.mutex.RLock()
+	defer id.mutex.RUnlock()
+
+	return id.nameFor(ip, mac)
+}
+
+// nameFor implements NameFor; the caller must hold the mutex
+func (id *Identifier) nameFor(ip, mac string) string {
+	if name, ok := id.names[mac]; ok && mac != "" {
+		return name
+	}
+	return id.names[ip]
+}
+
+// resolve performs a reverse DNS lookup for ip and caches the result,
+// including failures so unresolvable clients are not retried every packet
+func (id *Identifier) resolve(ip string) {
+	ctx, cancel := context.WithTimeout(context.Background(), reverseDNSTimeout)
+	defer cancel()
+
+	hostname := ""
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+	if err != nil {
+		logger.Logf(types.LogDebug, "Reverse DNS lookup for %s failed: %v", ip, err)
+	} else if len(names) > 0 {
+		hostname = strings.TrimSuffix(names[0], ".")
+		logger.Logf(types.LogDebug, "Reverse DNS for %s: %s", ip, hostname)
+	}
+
+	id.mutex.Lock()
+	defer id.mutex.Unlock()
+
+	id.hostnames[ip] = hostnameEntry{hostname: hostname, resolvedAt: time.Now()}
+	delete(id.pending, ip)
+}
+
+// Names returns a copy of the friendly-name mapping
+func (id *Identifier) Names() map[string]string {
+	id.mutex.RLock()
+	defer id.mutex.RUnlock()
+
+	names := make(map[string]string, len(id.names))
+	for key, name := range id.names {
+		names[key] = name
+	}
+	return names
+}
+
+// SetName assigns a friendly name to a MAC address or IP, removing the
+// entry when name is empty. The mapping is written back to the names file
+// when one is configured; the returned bool reports whether it was.
+func (id *Identifier) SetName(key, name string) (bool, error) {
+	key = normalizeKey(key)
+	if net.ParseIP(key) == nil {
+		if _, err := net.ParseMAC(key); err != nil {
+			return false, fmt.Errorf("'%s' is neither an IP nor a MAC address", key)
+		}
+	}
+
+	id.mutex.Lock()
+	defer id.mutex.Unlock()
+
+	// Change a copy so a failed write leaves the names in use untouched
+	names := make(map[string]string, len(id.names)+1)
+	for k, v := range id.names {
+		names[k] = v
+	}
+	if name == "" {
+		delete(names, key)
+	} else {
+		names[key] = name
+	}
+
+	if id.namesFile != "" {
+		if err := writeNames(id.namesFile, names); err != nil {
+			return false, err
+		}
+	}
+	id.names = names
+	return id.namesFile != "", nil
+}
+
+// writeNames atomically replaces the names file with the given mapping
+func writeNames(path string, names map[string]string) error {
+	data, err := json.MarshalIndent(names, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode client names: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".client-names-*")
+	if err != nil {
+		return fmt.Errorf("failed to write client names file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write client names file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write client names file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace client names file: %v", err)
+	}
+	return nil
+}
+
+// normalizeKey rewrites MAC addresses in the colon-separated lowercase form
+// used by the neighbor table so lookups match however the key was written
+func normalizeKey(key string) string {
+	key = strings.TrimSpace(key)
+	if hw, err := net.ParseMAC(key); err == nil {
+		return hw.String()
+	}
+	return strings.ToLower(key)
+}
@@ -3,15 +3,20 @@ package config
 import (
 	"fmt"
 	"net"
-	"os"
+	"strconv"
 	"strings"
 
 	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/logging"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/options"
 	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/server"
 	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
 )
 
-// Load loads configuration from environment variables.
+// logger tags this package's log records with the config component
+var logger = logging.Component("config")
+
+// Load loads configuration from environment variables (or the equivalent
+// command-line flags, see options.All).
 //
 // Recognized variables:
 //   JELLYFIN_SERVER_URL  - URL the proxy fetches /System/Info/Public from.
@@ -23,28 +28,28 @@ import (
 //                          carrying this URL so dual-stack clients see a
 //                          v6 endpoint too.
 func Load() (*types.Config, error) {
-	serverURL := os.Getenv("JELLYFIN_SERVER_URL")
+	serverURL := options.Get("JELLYFIN_SERVER_URL")
 	if serverURL == "" {
-		logging.Logln(types.LogInfo, "JELLYFIN_SERVER_URL not set, using default http://localhost:8096")
-		serverURL = "http://localhost:8096"
+		serverURL = options.Default("JELLYFIN_SERVER_URL")
+		logger.Logf(types.LogInfo, "JELLYFIN_SERVER_URL not set, using default %s", serverURL)
 	}
 
-	proxyURL := os.Getenv("PROXY_URL")
+	proxyURL := options.Get("PROXY_URL")
 	if proxyURL == "" {
-		logging.Logln(types.LogInfo, "PROXY_URL not set, using JELLYFIN_SERVER_URL for the Address field")
+		logger.Logln(types.LogInfo, "PROXY_URL not set, using JELLYFIN_SERVER_URL for the Address field")
 		proxyURL = serverURL
 	} else {
-		logging.Logf(types.LogInfo, "PROXY_URL set to %s, will use for Address field in responses", proxyURL)
+		logger.Logf(types.LogInfo, "PROXY_URL set to %s, will use for Address field in responses", proxyURL)
 		if server.IsHostname(proxyURL) {
-			logging.Logln(types.LogInfo, "PROXY_URL is a hostname, will broadcast both hostname and IP responses for non-Avahi device compatibility")
+			logger.Logln(types.LogInfo, "PROXY_URL is a hostname, will broadcast both hostname and IP responses for non-Avahi device compatibility")
 		}
 	}
 
-	proxyURLv6 := os.Getenv("PROXY_URL_IPV6")
+	proxyURLv6 := options.Get("PROXY_URL_IPV6")
 	if proxyURLv6 != "" {
-		logging.Logf(types.LogInfo, "PROXY_URL_IPV6 set to %s, will emit a second discovery response per request", proxyURLv6)
+		logger.Logf(types.LogInfo, "PROXY_URL_IPV6 set to %s, will emit a second discovery response per request", proxyURLv6)
 		if server.IsHostname(proxyURLv6) {
-			logging.Logf(types.LogDebug, "PROXY_URL_IPV6 is a hostname: %s", proxyURLv6)
+			logger.Logf(types.LogDebug, "PROXY_URL_IPV6 is a hostname: %s", proxyURLv6)
 		}
 	}
 
@@ -52,13 +57,13 @@ func Load() (*types.Config, error) {
 	proxyURL = strings.TrimSuffix(proxyURL, "/")
 	proxyURLv6 = strings.TrimSuffix(proxyURLv6, "/")
 
-	logging.Logf(types.LogInfo, "Target Jellyfin server: %s", serverURL)
-	logging.Logf(types.LogDebug, "Resolved URLs - server: '%s', proxy: '%s', proxyV6: '%s'", serverURL, proxyURL, proxyURLv6)
+	logger.Logf(types.LogInfo, "Target Jellyfin server: %s", serverURL)
+	logger.Logf(types.LogDebug, "Resolved URLs - server: '%s', proxy: '%s', proxyV6: '%s'", serverURL, proxyURL, proxyURLv6)
 
-	networkInterface := os.Getenv("NETWORK_INTERFACE")
+	networkInterface := options.Get("NETWORK_INTERFACE")
 	var bindIP string
 	if networkInterface != "" {
-		logging.Logf(types.LogInfo, "NETWORK_INTERFACE set to: %s", networkInterface)
+		logger.Logf(types.LogInfo, "NETWORK_INTERFACE set to: %s", networkInterface)
 		iface, err := net.InterfaceByName(networkInterface)
 		if err != nil {
 			return nil, fmt.Errorf("failed to find network interface '%s': %v", networkInterface, err)
@@ -73,7 +78,7 @@ func Load() (*types.Config, error) {
 			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
 				if ipnet.IP.To4() != nil {
 					bindIP = ipnet.IP.String()
-					logging.Logf(types.LogInfo, "Binding to interface %s with IP: %s", networkInterface, bindIP)
+					logger.Logf(types.LogInfo, "Binding to interface %s with IP: %s", networkInterface, bindIP)
 					break
 				}
 			}
@@ -84,15 +89,51 @@ func Load() (*types.Config, error) {
 		}
 	} else {
 		bindIP = "0.0.0.0"
-		logging.Logln(types.LogInfo, "No NETWORK_INTERFACE specified, binding to all interfaces")
+		logger.Logln(types.LogInfo, "No NETWORK_INTERFACE specified, binding to all interfaces")
 	}
 
-	httpPort := os.Getenv("HTTP_PORT")
+	httpPort := options.Get("HTTP_PORT")
 	if httpPort == "" {
-		httpPort = "8080"
-		logging.Logln(types.LogInfo, "HTTP_PORT not set, using default port 8080")
+		httpPort = options.Default("HTTP_PORT")
+		logger.Logf(types.LogInfo, "HTTP_PORT not set, using default port %s", httpPort)
 	} else {
-		logging.Logf(types.LogInfo, "HTTP_PORT set to: %s", httpPort)
+		logger.Logf(types.LogInfo, "HTTP_PORT set to: %s", httpPort)
+	}
+
+	httpEnabled := true
+	if value := options.Get("HTTP_ENABLED"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HTTP_ENABLED value '%s': must be true or false", value)
+		}
+		httpEnabled = enabled
+	}
+
+	httpBind := options.Get("HTTP_BIND")
+	if httpBind != "" && !strings.HasPrefix(httpBind, "unix:") && net.ParseIP(httpBind) == nil {
+		return nil, fmt.Errorf("invalid HTTP_BIND value '%s': must be an IP address or unix:/path/to/socket", httpBind)
+	}
+	if httpBind == "unix:" {
+		return nil, fmt.Errorf("invalid HTTP_BIND value '%s': socket path is missing", httpBind)
+	}
+
+	httpBasePath := "/" + strings.Trim(options.Get("HTTP_BASE_PATH"), "/")
+	if httpBasePath == "/" {
+		httpBasePath = ""
+	}
+	if strings.ContainsAny(httpBasePath, "?#") {
+		return nil, fmt.Errorf("invalid HTTP_BASE_PATH value '%s': must be a plain path such as /jdp", httpBasePath)
+	}
+
+	trustedProxies, err := parseNetworks(options.Get("TRUSTED_PROXIES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TRUSTED_PROXIES value: %v", err)
+	}
+
+	tlsCertFile := options.Get("TLS_CERT_FILE")
+	tlsKeyFile := options.Get("TLS_KEY_FILE")
+	if (tlsCertFile == "") != (tlsKeyFile == "") {
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
 	}
 
 	return &types.Config{
@@ -101,6 +142,43 @@ func Load() (*types.Config, error) {
 		ProxyURLv6:       proxyURLv6,
 		NetworkInterface: networkInterface,
 		BindIP:           bindIP,
+		HTTPEnabled:      httpEnabled,
+		HTTPBind:         httpBind,
 		HTTPPort:         httpPort,
+		HTTPBasePath:     httpBasePath,
+		TrustedProxies:   trustedProxies,
+		TLSCertFile:      tlsCertFile,
+		TLSKeyFile:       tlsKeyFile,
 	}, nil
 }
+
+// parseNetworks parses a comma-separated list of IPs and CIDR subnets.
+// A single IP is treated as a subnet containing only that address.
+func parseNetworks(list string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("'%s' is neither an IP nor a subnet", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is neither an IP nor a subnet", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
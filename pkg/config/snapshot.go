@@ -0,0 +1,199 @@
+package config
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/auth"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/blacklist"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/cache"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/clients"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/hooks"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/logging"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/options"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// Snapshot is the complete set of reloadable settings. The request path
+// reads one snapshot per packet, so a reload never exposes half-applied
+// state to a discovery client.
+type Snapshot struct {
+	Config        *types.Config
+	Blacklist     *types.IPBlacklist
+	Auth          *auth.Config
+	MACFilter     *types.MACFilter
+	Hooks         *hooks.HookConfig
+	HookDispatch  hooks.DispatchConfig
+	CacheDuration time.Duration
+	ClientExpiry  time.Duration
+	ClientNames   string
+	ReverseDNS    bool
+	LogLevel      string
+	LogLevels     string
+	LogFormat     string
+	LogOutputs    logging.OutputConfig
+	LogDedup      logging.DedupConfig
+	LogBufferSize int
+	Values        map[string]string
+}
+
+// Store holds the active snapshot and swaps it atomically on reload
+type Store struct {
+	snapshot *Snapshot
+	mutex    sync.RWMutex
+}
+
+// NewStore creates a store holding the given snapshot
+func NewStore(snapshot *Snapshot) *Store {
+	return &Store{snapshot: snapshot}
+}
+
+// Get returns the active snapshot
+func (s *Store) Get() *Snapshot {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.snapshot
+}
+
+// Set replaces the active snapshot
+func (s *Store) Set(snapshot *Snapshot) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.snapshot = snapshot
+}
+
+// InvalidError reports a configuration that was read but rejected, as
+// opposed to a failure applying a valid one
+type InvalidError struct {
+	Err error
+}
+
+// Error implements error
+func (e *InvalidError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *InvalidError) Unwrap() error {
+	return e.Err
+}
+
+// LoadFile re-reads CONFIG_FILE, when set, into the options file layer
+func LoadFile() error {
+	path := options.Get("CONFIG_FILE")
+	if path == "" {
+		return nil
+	}
+
+	warnings, err := options.LoadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file '%s': %v", path, err)
+	}
+	for _, warning := range warnings {
+		logger.Logf(types.LogWarn, "Ignoring %s", warning)
+	}
+	logger.Logf(types.LogInfo, "Loaded configuration file %s", path)
+	return nil
+}
+
+// LogLevel returns the configured log level name
+func LogLevel() string {
+	level := options.Get("LOG_LEVEL")
+	if level == "" {
+		level = options.Default("LOG_LEVEL")
+	}
+	return level
+}
+
+// LoadSnapshot loads the proxy configuration, IP and MAC access rules,
+// hooks, cache duration and client settings from the current option values.
+func LoadSnapshot() (*Snapshot, error) {
+	cfg, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	authConfig, err := auth.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	ipBlacklist := blacklist.New(options.Get("BLACKLIST"))
+	if ipBlacklist.Count() > 0 {
+		logger.Logf(types.LogInfo, "Loaded %d IP(s) into blacklist", ipBlacklist.Count())
+	}
+
+	macFilter := blacklist.NewMACFilter(options.Get("MAC_ALLOWLIST"), options.Get("MAC_DENYLIST"), options.Get("MAC_UNRESOLVED"))
+	if macFilter.Active() {
+		mode := "allowed"
+		if !macFilter.AllowUnresolved {
+			mode = "ignored"
+		}
+		logger.Logf(types.LogInfo, "Loaded %d MAC allow rule(s) and %d MAC deny rule(s); clients with unresolved MACs will be %s", len(macFilter.Allow), len(macFilter.Deny), mode)
+	}
+
+	hookConfig, err := hooks.LoadHookConfig()
+	if err != nil {
+		return nil, err
+	}
+	if hookConfig.OnReceiveURL != "" || hookConfig.OnReceiveCmd != "" {
+		logger.Logf(types.LogInfo, "onReceive hook configured")
+		logger.Logf(types.LogDebug, "onReceive URL: %s, CMD: %s", hookConfig.OnReceiveURL, hookConfig.OnReceiveCmd)
+	}
+	if hookConfig.OnSendURL != "" || hookConfig.OnSendCmd != "" {
+		logger.Logf(types.LogInfo, "onSend hook configured")
+		logger.Logf(types.LogDebug, "onSend URL: %s, CMD: %s", hookConfig.OnSendURL, hookConfig.OnSendCmd)
+	}
+
+	return &Snapshot{
+		Config:        cfg,
+		Blacklist:     ipBlacklist,
+		Auth:          authConfig,
+		MACFilter:     macFilter,
+		Hooks:         hookConfig,
+		HookDispatch:  hooks.GetDispatchConfig(),
+		CacheDuration: cache.GetDuration(),
+		ClientExpiry:  clients.GetExpiry(),
+		ClientNames:   options.Get("CLIENT_NAMES_FILE"),
+		ReverseDNS:    clients.ReverseDNSEnabled(),
+		LogLevel:      LogLevel(),
+		LogLevels:     options.Get("LOG_LEVELS"),
+		LogFormat:     options.Get("LOG_FORMAT"),
+		LogOutputs:    logging.GetOutputConfig(),
+		LogDedup:      logging.GetDedupConfig(),
+		LogBufferSize: logging.GetLogBufferSize(),
+		Values:        options.Values(),
+	}, nil
+}
+
+// Diff describes every option whose value differs between two snapshots,
+// in options.All order, followed by resolved values that changed while
+// their options did not, such as the address of NETWORK_INTERFACE or the
+// contents of a webhook secret file.
+func Diff(old, new *Snapshot) []string {
+	var changes []string
+	for _, opt := range options.All {
+		before, after := old.Values[opt.Env], new.Values[opt.Env]
+		if before == after {
+			continue
+		}
+		if opt.Secret {
+			changes = append(changes, fmt.Sprintf("%s: changed (value hidden)", opt.Env))
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s: '%s' -> '%s'", opt.Env, before, after))
+	}
+
+	if old.Config.BindIP != new.Config.BindIP && old.Values["NETWORK_INTERFACE"] == new.Values["NETWORK_INTERFACE"] {
+		changes = append(changes, fmt.Sprintf("NETWORK_INTERFACE: address of '%s' changed from '%s' to '%s'", new.Config.NetworkInterface, old.Config.BindIP, new.Config.BindIP))
+	}
+	for _, env := range hooks.AuthChanges(old.Hooks, new.Hooks) {
+		if old.Values[env] == new.Values[env] {
+			changes = append(changes, fmt.Sprintf("%s: file contents changed (value hidden)", env))
+		}
+	}
+	return changes
+}
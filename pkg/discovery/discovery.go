@@ -2,163 +2,270 @@ package discovery
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"net"
 	"strings"
 	"time"
 
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/clients"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/config"
 	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/hooks"
 	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/logging"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/metrics"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/neighbors"
 	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/server"
 	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
 )
 
+// logger tags this package's log records with the discovery component
+var logger = logging.Component("discovery")
+
+// macResolveWait bounds how long a request with MAC rules active waits for
+// an unknown client's MAC address to be resolved
+const macResolveWait = 500 * time.Millisecond
+
 // ListenLoop listens for IPv4 discovery requests on a single UDP socket and
-// emits responses for proxyURL plus, when configured, proxyURLv6 so
-// dual-stack clients can pick whichever endpoint they prefer.
+// emits responses for the proxy URL plus, when configured, the IPv6 proxy
+// URL so dual-stack clients can pick whichever endpoint they prefer. The
+// active configuration snapshot is read per packet so reloads apply to the
+// next request without rebinding. Every return from a read is recorded in
+// state so readiness checks can tell a stalled or failing loop.
 func ListenLoop(ctx context.Context, conn *net.UDPConn,
-	serverURL, proxyURL, proxyURLv6 string,
+	store *config.Store,
 	cache *types.ServerInfoCache,
-	blacklist *types.IPBlacklist, stats *types.RequestStats, hookConfig *hooks.HookConfig) {
+	stats *types.RequestStats, registry *types.ClientRegistry, identifier *clients.Identifier,
+	state *types.ListenerState) {
 	buffer := make([]byte, 1024)
-	logging.Logf(types.LogDebug, "Listener started for %s with buffer size: %d bytes", conn.LocalAddr(), len(buffer))
+	logger.Logf(types.LogDebug, "Listener started for %s with buffer size: %d bytes", conn.LocalAddr(), len(buffer))
+
+	generation := state.Start(conn.LocalAddr().String())
+	defer state.Stop(generation)
 
 	for {
 		select {
 		case <-ctx.Done():
-			logging.Logf(types.LogDebug, "Context cancelled, stopping listener for %s", conn.LocalAddr())
+			logger.Logf(types.LogDebug, "Context cancelled, stopping listener for %s", conn.LocalAddr())
 			return
 		default:
 		}
 
 		conn.SetReadDeadline(time.Now().Add(1 * time.Second))
 
-		logging.Logf(types.LogDebug, "Waiting for UDP packet on %s", conn.LocalAddr())
+		logger.Logf(types.LogDebug, "Waiting for UDP packet on %s", conn.LocalAddr())
 		n, addr, err := conn.ReadFromUDP(buffer)
 		if err != nil {
 			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				state.Poll(generation, nil)
 				continue
 			}
 			if ctx.Err() != nil {
-				logging.Logf(types.LogDebug, "Connection closed during shutdown: %s", conn.LocalAddr())
+				logger.Logf(types.LogDebug, "Connection closed during shutdown: %s", conn.LocalAddr())
 				return
 			}
-			logging.Logf(types.LogError, "Error reading UDP message: %v", err)
-			logging.Logf(types.LogDebug, "UDP read error type: %T, connection: %s", err, conn.LocalAddr())
+			state.Poll(generation, err)
+			logger.Logf(types.LogError, "Error reading UDP message: %v", err)
+			logger.Logf(types.LogDebug, "UDP read error type: %T, connection: %s", err, conn.LocalAddr())
 			continue
 		}
 
+		state.Poll(generation, nil)
+		metrics.RequestsReceived.Inc()
+		stats.RecordEvent(types.RateReceived)
 		message := string(buffer[:n])
-		logging.Logf(types.LogInfo, "Received discovery request from %s (%d bytes): %s", addr.String(), n, message)
-		logging.Logf(types.LogDebug, "Message hex dump: % X", buffer[:n])
-		logging.Logf(types.LogDebug, "Remote address details - IP: %s, Port: %d, Zone: %s", addr.IP, addr.Port, addr.Zone)
+		// Identification reads the neighbor table, so it waits until the
+		// message is known to be a discovery request
+		reqLogger := requestLogger(addr.IP.String())
+		from := addr.String()
+		reqLogger.Logf(types.LogInfo, "Received discovery request from %s (%d bytes): %s", from, n, message)
+		reqLogger.Logf(types.LogDebug, "Message hex dump: % X", buffer[:n])
+		reqLogger.Logf(types.LogDebug, "Remote address details - IP: %s, Port: %d, Zone: %s", addr.IP, addr.Port, addr.Zone)
 
-		if strings.EqualFold(message, "Who is JellyfinServer?") {
-			logging.Logf(types.LogDebug, "Valid Jellyfin discovery request detected, spawning handler goroutine")
-			go HandleRequest(conn, addr, serverURL, proxyURL, proxyURLv6, cache, blacklist, stats, hookConfig)
+		if strings.EqualFold(message, types.DiscoveryMessage) {
+			reqLogger.Logf(types.LogDebug, "Valid Jellyfin discovery request detected, spawning handler goroutine")
+			go HandleRequest(conn, addr, identifier, store.Get(), cache, stats, registry, reqLogger)
 		} else {
-			logging.Logf(types.LogWarn, "Ignoring unrecognized message from %s: %s", addr.String(), message)
-			logging.Logf(types.LogDebug, "Expected 'Who is JellyfinServer?' but got '%s'", message)
+			metrics.RequestsIgnored.Inc("unrecognized_message")
+			reqLogger.Logf(types.LogWarn, "Ignoring unrecognized message from %s: %s", from, message)
+			reqLogger.Logf(types.LogDebug, "Expected '%s' but got '%s'", types.DiscoveryMessage, message)
 		}
 	}
 }
 
-// HandleRequest processes a discovery request, fetching server info if the
-// cache is cold, then emitting the primary response and (when configured) a
-// second response carrying proxyURLv6.
-func HandleRequest(conn *net.UDPConn, addr *net.UDPAddr,
-	serverURL, proxyURL, proxyURLv6 string,
+// HandleRequest identifies the client of a discovery request, fetching
+// server info if the cache is cold, then emitting the primary response and
+// (when configured) a second response carrying the IPv6 proxy URL.
+func HandleRequest(conn *net.UDPConn, addr *net.UDPAddr, identifier *clients.Identifier,
+	snapshot *config.Snapshot,
 	cache *types.ServerInfoCache,
-	blacklist *types.IPBlacklist, stats *types.RequestStats, hookConfig *hooks.HookConfig) {
-	logging.Logf(types.LogInfo, "Processing discovery request from %s", addr.String())
-	logging.Logf(types.LogDebug, "Handler goroutine started for request from %s", addr.String())
-
+	stats *types.RequestStats, registry *types.ClientRegistry, reqLogger *logging.Entry) {
 	clientIP := addr.IP.String()
-	if blacklist.IsBlocked(clientIP) {
-		logging.Logf(types.LogWarn, "Ignoring request from blacklisted IP: %s", clientIP)
+
+	// Check the blacklist before identifying the client, which may probe it
+	// and wait for its MAC address
+	if snapshot.Blacklist.IsBlocked(clientIP) {
+		client := types.ClientIdentity{IP: clientIP, Name: identifier.NameFor(clientIP, "")}
+		reqLogger.Logf(types.LogWarn, "Ignoring request from blacklisted IP: %s", client.Format(clientIP))
+		metrics.RequestsBlocked.Inc("blacklist")
+		stats.RecordEvent(types.RateBlocked)
+		registry.RecordRequest(client, addr.Port)
+		registry.RecordBlocked(clientIP)
+		return
+	}
+
+	client := identifier.Identify(clientIP)
+	if client.MAC == "" && snapshot.MACFilter.Active() {
+		// MAC rules need the address; make the kernel resolve a client
+		// that has not been sent anything yet
+		if mac := neighbors.Resolve(clientIP, macResolveWait); mac != "" {
+			reqLogger.Logf(types.LogDebug, "Resolved MAC address %s for %s after probing", mac, addr.IP)
+			client.MAC = mac
+			client.Name = identifier.NameFor(client.IP, mac)
+		}
+	}
+	if client.MAC != "" {
+		reqLogger = reqLogger.WithFields(types.LogFields{"client_mac": client.MAC})
+	}
+	from := client.Format(addr.String())
+	reqLogger.Logf(types.LogInfo, "Processing discovery request from %s", from)
+	reqLogger.Logf(types.LogDebug, "Handler goroutine started for request from %s", addr.String())
+
+	cfg := snapshot.Config
+	hookConfig := snapshot.Hooks
+
+	registry.RecordRequest(client, addr.Port)
+
+	allowed, resolved := snapshot.MACFilter.Evaluate(client.MAC)
+	if !resolved {
+		decision := "answering anyway (MAC_UNRESOLVED=allow)"
+		if !allowed {
+			decision = "ignoring request (MAC_UNRESOLVED=deny)"
+		}
+		reqLogger.Logf(types.LogWarn, "Could not resolve MAC address for %s (not in the neighbor table), %s", from, decision)
+	}
+	if !allowed {
+		reason := "mac_rule"
+		if resolved {
+			reqLogger.Logf(types.LogWarn, "Ignoring request from %s blocked by MAC rules", from)
+		} else {
+			reason = "mac_unresolved"
+		}
+		metrics.RequestsBlocked.Inc(reason)
+		stats.RecordEvent(types.RateBlocked)
+		registry.RecordBlocked(clientIP)
 		return
 	}
 
 	hookConfig.ExecuteOnReceive(hooks.OnReceivePayload{
-		Timestamp:   time.Now(),
-		ClientIP:    clientIP,
-		ClientPort:  addr.Port,
-		Message:     "Who is JellyfinServer?",
-		LocalSocket: conn.LocalAddr().String(),
+		Timestamp:      time.Now(),
+		ClientIP:       clientIP,
+		ClientPort:     addr.Port,
+		ClientMAC:      client.MAC,
+		ClientHostname: client.Hostname,
+		ClientName:     client.Name,
+		Message:        types.DiscoveryMessage,
+		LocalSocket:    conn.LocalAddr().String(),
 	})
 
 	stats.RecordRequest(clientIP)
 
-	logging.Logln(types.LogDebug, "Checking cache for server info")
+	reqLogger.Logln(types.LogDebug, "Checking cache for server info")
 	serverInfo := cache.Get()
 
 	if serverInfo == nil {
-		logging.Logln(types.LogInfo, "Cache expired or empty, fetching fresh server info from Jellyfin")
-		logging.Logf(types.LogDebug, "Cache miss - last cached at: %v, cache duration: %v", cache.Timestamp, cache.Duration)
+		metrics.CacheMisses.Inc()
+		reqLogger.Logln(types.LogInfo, "Cache expired or empty, fetching fresh server info from Jellyfin")
+		reqLogger.Logf(types.LogDebug, "Cache miss - last cached at: %v, cache duration: %v", cache.Timestamp, cache.Duration)
 
 		var err error
-		serverInfo, err = server.FetchInfo(serverURL)
+		serverInfo, err = server.FetchInfo(cfg.ServerURL)
 		if err != nil {
-			logging.Logf(types.LogError, "Failed to fetch server info: %v", err)
-			logging.Logf(types.LogDebug, "Fetch error type: %T", err)
-			logging.Logf(types.LogWarn, "Not responding to discovery request from %s - server is unreachable", addr.String())
+			reqLogger.Logf(types.LogError, "Failed to fetch server info: %v", err)
+			reqLogger.Logf(types.LogDebug, "Fetch error type: %T", err)
+			reqLogger.Logf(types.LogWarn, "Not responding to discovery request from %s - server is unreachable", from)
+			metrics.RequestsIgnored.Inc("upstream_unavailable")
+			stats.RecordEvent(types.RateUpstreamFailure)
 			return
 		}
 
 		cache.Set(serverInfo)
-		logging.Logln(types.LogInfo, "Successfully updated cache with fresh server info")
-		logging.Logf(types.LogDebug, "Cache updated at: %v", cache.Timestamp)
+		reqLogger.Logln(types.LogInfo, "Successfully updated cache with fresh server info")
+		reqLogger.Logf(types.LogDebug, "Cache updated at: %v", cache.Timestamp)
 	} else {
-		logging.Logln(types.LogInfo, "Using cached server info for response")
-		logging.Logf(types.LogDebug, "Cache hit - age: %v, cached at: %v", time.Since(cache.Timestamp), cache.Timestamp)
+		metrics.CacheHits.Inc()
+		reqLogger.Logln(types.LogInfo, "Using cached server info for response")
+		reqLogger.Logf(types.LogDebug, "Cache hit - age: %v, cached at: %v", time.Since(cache.Timestamp), cache.Timestamp)
 	}
 
-	sendForURL(conn, addr, proxyURL, serverInfo, hookConfig, "primary")
+	reqLogger = reqLogger.With("server_id", serverInfo.Id)
+	sent := sendForURL(conn, addr, client, cfg.ProxyURL, serverInfo, hookConfig, "primary", reqLogger)
 
 	// Only emit a second response when an IPv6-specific URL was configured;
 	// otherwise it would just duplicate the primary payload.
-	if proxyURLv6 != "" && proxyURLv6 != proxyURL {
-		sendForURL(conn, addr, proxyURLv6, serverInfo, hookConfig, "IPv6")
+	if cfg.ProxyURLv6 != "" && cfg.ProxyURLv6 != cfg.ProxyURL {
+		sent += sendForURL(conn, addr, client, cfg.ProxyURLv6, serverInfo, hookConfig, "IPv6", reqLogger)
 	}
 
-	logging.Logf(types.LogDebug, "Handler goroutine completed for %s", addr.String())
+	if sent > 0 {
+		metrics.RequestsAnswered.Inc()
+		stats.RecordEvent(types.RateAnswered)
+		for i := 0; i < sent; i++ {
+			registry.RecordResponse(clientIP)
+		}
+	}
+
+	reqLogger.Logf(types.LogDebug, "Handler goroutine completed for %s", addr.String())
 }
 
 // sendForURL dispatches the discovery response for a single advertised URL,
 // expanding hostnames to "hostname + resolved IP" pairs for non-Avahi device
 // compatibility (matches the behavior the proxy has had since hostnames were
-// first supported).
-func sendForURL(conn *net.UDPConn, addr *net.UDPAddr, advertisedURL string, serverInfo *types.SystemInfoResponse, hookConfig *hooks.HookConfig, label string) {
+// first supported). It returns the number of responses sent.
+func sendForURL(conn *net.UDPConn, addr *net.UDPAddr, client types.ClientIdentity, advertisedURL string, serverInfo *types.SystemInfoResponse, hookConfig *hooks.HookConfig, label string, reqLogger *logging.Entry) int {
 	if advertisedURL == "" {
-		return
+		return 0
 	}
 
+	sent := 0
+	responseType := strings.ToLower(label)
+
 	if server.IsHostname(advertisedURL) {
-		logging.Logf(types.LogInfo, "Sending dual %s responses (hostname + IP) for non-Avahi device compatibility", label)
-		logging.Logf(types.LogDebug, "%s dual response mode enabled for hostname: %s", label, advertisedURL)
+		reqLogger.Logf(types.LogInfo, "Sending dual %s responses (hostname + IP) for non-Avahi device compatibility", label)
+		reqLogger.Logf(types.LogDebug, "%s dual response mode enabled for hostname: %s", label, advertisedURL)
 
-		SendResponse(conn, addr, advertisedURL, serverInfo, hookConfig)
+		if SendResponse(conn, addr, client, advertisedURL, serverInfo, hookConfig, reqLogger) == nil {
+			metrics.ResponsesSent.Inc(responseType)
+			sent++
+		}
 
-		logging.Logf(types.LogDebug, "Attempting to resolve %s hostname %s to IP", label, advertisedURL)
+		reqLogger.Logf(types.LogDebug, "Attempting to resolve %s hostname %s to IP", label, advertisedURL)
 		ipURL, err := server.ResolveHostnameToIP(advertisedURL)
 		if err != nil {
-			logging.Logf(types.LogWarn, "Could not resolve %s hostname %s to IP: %v", label, advertisedURL, err)
-			logging.Logf(types.LogDebug, "%s DNS resolution error type: %T", label, err)
-			return
+			reqLogger.Logf(types.LogWarn, "Could not resolve %s hostname %s to IP: %v", label, advertisedURL, err)
+			reqLogger.Logf(types.LogDebug, "%s DNS resolution error type: %T", label, err)
+			return sent
 		}
-		logging.Logf(types.LogInfo, "Resolved %s %s to %s, sending second response", label, advertisedURL, ipURL)
-		logging.Logf(types.LogDebug, "%s hostname resolved successfully to: %s", label, ipURL)
-		SendResponse(conn, addr, ipURL, serverInfo, hookConfig)
-		return
+		reqLogger.Logf(types.LogInfo, "Resolved %s %s to %s, sending second response", label, advertisedURL, ipURL)
+		reqLogger.Logf(types.LogDebug, "%s hostname resolved successfully to: %s", label, ipURL)
+		if SendResponse(conn, addr, client, ipURL, serverInfo, hookConfig, reqLogger) == nil {
+			metrics.ResponsesSent.Inc("hostname_resolved")
+			sent++
+		}
+		return sent
 	}
 
-	logging.Logf(types.LogDebug, "%s single response mode - sending one discovery response", label)
-	SendResponse(conn, addr, advertisedURL, serverInfo, hookConfig)
+	reqLogger.Logf(types.LogDebug, "%s single response mode - sending one discovery response", label)
+	if SendResponse(conn, addr, client, advertisedURL, serverInfo, hookConfig, reqLogger) == nil {
+		metrics.ResponsesSent.Inc(responseType)
+		sent++
+	}
+	return sent
 }
 
 // SendResponse sends a single discovery response to the client.
-func SendResponse(conn *net.UDPConn, addr *net.UDPAddr, addressURL string, serverInfo *types.SystemInfoResponse, hookConfig *hooks.HookConfig) {
-	logging.Logf(types.LogDebug, "Constructing discovery response for %s", addr.String())
+func SendResponse(conn *net.UDPConn, addr *net.UDPAddr, client types.ClientIdentity, addressURL string, serverInfo *types.SystemInfoResponse, hookConfig *hooks.HookConfig, reqLogger *logging.Entry) error {
+	reqLogger.Logf(types.LogDebug, "Constructing discovery response for %s", addr.String())
 
 	response := types.JellyfinDiscoveryResponse{
 		Address:         addressURL,
@@ -166,34 +273,50 @@ func SendResponse(conn *net.UDPConn, addr *net.UDPAddr, addressURL string, serve
 		Name:            serverInfo.ServerName,
 		EndpointAddress: nil,
 	}
-	logging.Logf(types.LogDebug, "Response struct - Address: %s, Id: %s, Name: %s", response.Address, response.Id, response.Name)
+	reqLogger.Logf(types.LogDebug, "Response struct - Address: %s, Id: %s, Name: %s", response.Address, response.Id, response.Name)
 
 	jsonResponse, err := json.Marshal(response)
 	if err != nil {
-		logging.Logf(types.LogError, "Error marshaling JSON response: %v", err)
-		logging.Logf(types.LogDebug, "JSON marshal error type: %T", err)
-		return
+		reqLogger.Logf(types.LogError, "Error marshaling JSON response: %v", err)
+		reqLogger.Logf(types.LogDebug, "JSON marshal error type: %T", err)
+		return err
 	}
-	logging.Logf(types.LogDebug, "JSON response length: %d bytes", len(jsonResponse))
-	logging.Logf(types.LogDebug, "JSON response content: %s", string(jsonResponse))
+	reqLogger.Logf(types.LogDebug, "JSON response length: %d bytes", len(jsonResponse))
+	reqLogger.Logf(types.LogDebug, "JSON response content: %s", string(jsonResponse))
 
 	hookConfig.ExecuteOnSend(hooks.OnSendPayload{
-		Timestamp:     time.Now(),
-		ClientIP:      addr.IP.String(),
-		ClientPort:    addr.Port,
-		ServerID:      serverInfo.Id,
-		ServerName:    serverInfo.ServerName,
-		AddressURL:    addressURL,
-		ResponseBytes: len(jsonResponse),
+		Timestamp:      time.Now(),
+		ClientIP:       addr.IP.String(),
+		ClientPort:     addr.Port,
+		ClientMAC:      client.MAC,
+		ClientHostname: client.Hostname,
+		ClientName:     client.Name,
+		ServerID:       serverInfo.Id,
+		ServerName:     serverInfo.ServerName,
+		AddressURL:     addressURL,
+		ResponseBytes:  len(jsonResponse),
 	})
 
 	bytesWritten, err := conn.WriteToUDP(jsonResponse, addr)
 	if err != nil {
-		logging.Logf(types.LogError, "Error sending response to %s: %v", addr.String(), err)
-		logging.Logf(types.LogDebug, "UDP write error type: %T", err)
-		return
+		reqLogger.Logf(types.LogError, "Error sending response to %s: %v", client.Format(addr.String()), err)
+		reqLogger.Logf(types.LogDebug, "UDP write error type: %T", err)
+		return err
 	}
 
-	logging.Logf(types.LogInfo, "Sent discovery response to %s | Server: %s | Address: %s", addr.String(), serverInfo.ServerName, addressURL)
-	logging.Logf(types.LogDebug, "Successfully sent %d bytes to %s", bytesWritten, addr.String())
+	reqLogger.Logf(types.LogInfo, "Sent discovery response to %s | Server: %s | Address: %s", client.Format(addr.String()), serverInfo.ServerName, addressURL)
+	reqLogger.Logf(types.LogDebug, "Successfully sent %d bytes to %s", bytesWritten, addr.String())
+	return nil
+}
+
+// requestLogger returns a log entry tagging every line about one discovery
+// request with a random request_id and the client's address
+func requestLogger(clientIP string) *logging.Entry {
+	id := make([]byte, 4)
+	rand.Read(id)
+
+	return logger.WithFields(types.LogFields{
+		"request_id": hex.EncodeToString(id),
+		"client_ip":  clientIP,
+	})
 }
@@ -0,0 +1,163 @@
+package hooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/options"
+)
+
+// Headers added to signed webhooks. The signature is
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)), where
+// timestamp is the X-JDP-Timestamp value in Unix seconds. Each attempt is
+// signed again, so retries carry a fresh timestamp.
+const (
+	timestampHeader = "X-JDP-Timestamp"
+	signatureHeader = "X-JDP-Signature"
+)
+
+// WebhookAuth holds the extra headers, bearer token and signing secret
+// sent with one event's webhook
+type WebhookAuth struct {
+	Headers     http.Header
+	BearerToken string
+	Secret      []byte
+}
+
+// loadWebhookAuth reads the PREFIX_HEADERS, PREFIX_BEARER_TOKEN and
+// PREFIX_SECRET options; nil means none are set
+func loadWebhookAuth(prefix string) (*WebhookAuth, error) {
+	auth := &WebhookAuth{Headers: make(http.Header)}
+
+	for i, entry := range strings.Split(options.Get(prefix+"_HEADERS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, found := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		if !found || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid %s_HEADERS entry %d '%s': expected 'Name: value'", prefix, i+1, redactHeaderEntry(entry))
+		}
+		value, err := secretValue(prefix+"_HEADERS", strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+		auth.Headers.Add(textproto.CanonicalMIMEHeaderKey(name), value)
+	}
+
+	token, err := secretValue(prefix+"_BEARER_TOKEN", options.Get(prefix+"_BEARER_TOKEN"))
+	if err != nil {
+		return nil, err
+	}
+	auth.BearerToken = token
+
+	secret, err := secretValue(prefix+"_SECRET", options.Get(prefix+"_SECRET"))
+	if err != nil {
+		return nil, err
+	}
+	if secret != "" {
+		auth.Secret = []byte(secret)
+	}
+
+	if len(auth.Headers) == 0 && auth.BearerToken == "" && auth.Secret == nil {
+		return nil, nil
+	}
+	return auth, nil
+}
+
+// redactHeaderEntry shows enough of a malformed header entry to find it
+// while hiding anything that may be its value: the text before the first
+// ':', '=' or whitespace is kept and the rest replaced. An entry without
+// any of them may be a bare value and is hidden completely.
+func redactHeaderEntry(entry string) string {
+	end := strings.IndexAny(entry, ":= \t")
+	if end < 0 {
+		return "<redacted>"
+	}
+	return entry[:end] + entry[end:end+1] + "<redacted>"
+}
+
+// AuthChanges returns the webhook auth options whose resolved values differ
+// between two hook configurations, so changed secret files can be told
+// apart from unchanged ones even when the option values are the same
+func AuthChanges(old, new *HookConfig) []string {
+	var changes []string
+	for _, hook := range []struct {
+		prefix   string
+		old, new *WebhookAuth
+	}{
+		{"HOOK_ON_RECEIVE", old.OnReceiveAuth, new.OnReceiveAuth},
+		{"HOOK_ON_SEND", old.OnSendAuth, new.OnSendAuth},
+	} {
+		before, after := hook.old, hook.new
+		if before == nil {
+			before = &WebhookAuth{}
+		}
+		if after == nil {
+			after = &WebhookAuth{}
+		}
+		if len(before.Headers) != len(after.Headers) || (len(before.Headers) > 0 && !reflect.DeepEqual(before.Headers, after.Headers)) {
+			changes = append(changes, hook.prefix+"_HEADERS")
+		}
+		if before.BearerToken != after.BearerToken {
+			changes = append(changes, hook.prefix+"_BEARER_TOKEN")
+		}
+		if !bytes.Equal(before.Secret, after.Secret) {
+			changes = append(changes, hook.prefix+"_SECRET")
+		}
+	}
+	return changes
+}
+
+// secretValue returns value, or the contents of the file it names when it
+// starts with @, without the trailing newline
+func secretValue(env, value string) (string, error) {
+	if !strings.HasPrefix(value, "@") {
+		return value, nil
+	}
+	data, err := os.ReadFile(value[1:])
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s value: %v", env, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// apply adds the headers, bearer token and signature to a webhook request
+func (a *WebhookAuth) apply(req *http.Request, body []byte, now time.Time) {
+	if a == nil {
+		return
+	}
+
+	for name, values := range a.Headers {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	if a.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+a.BearerToken)
+	}
+	if a.Secret != nil {
+		timestamp := strconv.FormatInt(now.Unix(), 10)
+		req.Header.Set(timestampHeader, timestamp)
+		req.Header.Set(signatureHeader, sign(a.Secret, timestamp, body))
+	}
+}
+
+// sign returns the signature header value for a webhook body sent at
+// timestamp
+func sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
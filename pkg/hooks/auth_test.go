@@ -0,0 +1,73 @@
+package hooks
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      string
+		want      string
+	}{
+		{
+			name:      "payload",
+			secret:    "topsecret",
+			timestamp: "1700000000",
+			body:      `{"event":"onSend"}`,
+			want:      "sha256=ca0762aac17138d5cf24a39efdd6ca8d06e754a1192607a4619b4b5193ec1003",
+		},
+		{
+			name:      "empty body",
+			secret:    "k",
+			timestamp: "0",
+			body:      "",
+			want:      "sha256=6b4a4b8b3c40f1e8f53a3d36682e5f99f7ad2ac1df1c93dfe336f329167641e7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sign([]byte(tt.secret), tt.timestamp, []byte(tt.body)); got != tt.want {
+				t.Errorf("sign() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplySignsWithTimestamp(t *testing.T) {
+	auth := &WebhookAuth{Secret: []byte("topsecret")}
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com", nil)
+	body := []byte(`{"event":"onSend"}`)
+
+	auth.apply(req, body, time.Unix(1700000000, 0))
+
+	if got := req.Header.Get(timestampHeader); got != "1700000000" {
+		t.Errorf("%s = %s, want 1700000000", timestampHeader, got)
+	}
+	if got, want := req.Header.Get(signatureHeader), sign(auth.Secret, "1700000000", body); got != want {
+		t.Errorf("%s = %s, want %s", signatureHeader, got, want)
+	}
+}
+
+func TestRedactHeaderEntry(t *testing.T) {
+	tests := []struct {
+		entry string
+		want  string
+	}{
+		{"X-Api-Key=secret", "X-Api-Key=<redacted>"},
+		{"Bad Name: value", "Bad <redacted>"},
+		{": value", ":<redacted>"},
+		{"baresecret", "<redacted>"},
+	}
+
+	for _, tt := range tests {
+		if got := redactHeaderEntry(tt.entry); got != tt.want {
+			t.Errorf("redactHeaderEntry(%q) = %q, want %q", tt.entry, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package hooks
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/metrics"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// ErrNoDeadLetterFile is returned when dead letters are requested but
+// HOOK_DEAD_LETTER_FILE is not set
+var ErrNoDeadLetterFile = errors.New("no dead-letter file configured")
+
+// DeadLetter is a hook run that failed permanently, ran out of retries or
+// was abandoned at shutdown. Entries are stored one JSON object per line.
+type DeadLetter struct {
+	ID       string          `json:"id"`
+	Time     time.Time       `json:"time"`
+	Event    string          `json:"event"`
+	Type     string          `json:"type"`
+	Target   string          `json:"target"`
+	ClientIP string          `json:"client_ip"`
+	Payload  json.RawMessage `json:"payload"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+}
+
+// deadLetterMutex serializes appends and rewrites of the dead-letter file
+var deadLetterMutex sync.Mutex
+
+// deadLetter records a failed run in the queue counters and appends it to
+// the dead-letter file when one is configured. The caller must not hold
+// dispatchMutex.
+func deadLetter(q *hookQueue, j job, attempts int, cause error) {
+	dispatchMutex.Lock()
+	path := dispatch.DeadLetterFile
+	if path != "" {
+		q.status.DeadLettered++
+	}
+	dispatchMutex.Unlock()
+
+	jobLogger := logger.WithFields(types.LogFields{"client_ip": j.clientIP})
+	if path == "" {
+		jobLogger.Logf(types.LogWarn, "Discarding failed %s %s for %s, no dead-letter file configured", j.event, j.kind, j.clientIP)
+		return
+	}
+
+	entry := DeadLetter{
+		ID:       newDeadLetterID(),
+		Time:     time.Now().UTC(),
+		Event:    j.event,
+		Type:     j.kind,
+		Target:   j.target,
+		ClientIP: j.clientIP,
+		Payload:  json.RawMessage(j.payload),
+		Attempts: attempts,
+		Error:    cause.Error(),
+	}
+
+	deadLetterMutex.Lock()
+	err := appendDeadLetter(path, entry)
+	deadLetterMutex.Unlock()
+	if err != nil {
+		jobLogger.Logf(types.LogError, "Failed to dead-letter %s %s for %s: %v", j.event, j.kind, j.clientIP, err)
+		return
+	}
+
+	metrics.HookDeadLettered.Inc(j.event, j.kind)
+	jobLogger.Logf(types.LogWarn, "Dead-lettered %s %s for %s as %s", j.event, j.kind, j.clientIP, entry.ID)
+}
+
+// DeadLetters returns the entries in the dead-letter file, oldest first
+func DeadLetters() ([]DeadLetter, error) {
+	path, err := deadLetterPath()
+	if err != nil {
+		return nil, err
+	}
+
+	deadLetterMutex.Lock()
+	defer deadLetterMutex.Unlock()
+
+	return readDeadLetters(path)
+}
+
+// ReplayResult reports what ReplayDeadLetters did. Stale lists the IDs of
+// selected entries that were not replayed because their hook is no longer
+// configured or, for webhooks, now points at a different URL.
+type ReplayResult struct {
+	Replayed  int
+	Stale     []string
+	Remaining int
+}
+
+// ReplayDeadLetters queues the entries with the given IDs, or every entry
+// when ids is empty, and removes the queued ones from the file. Commands
+// run as currently configured in hc, never as stored in the file. Webhooks
+// are only replayed while hc still sends the event to the stored URL, so
+// the current headers, bearer token and signature never reach an endpoint
+// the operator has moved away from. Stale entries and entries that could not be queued
+// stay in the file; runs that fail again are dead-lettered under a new ID.
+func ReplayDeadLetters(hc *HookConfig, ids []string) (ReplayResult, error) {
+	var result ReplayResult
+	path, err := deadLetterPath()
+	if err != nil {
+		return result, err
+	}
+
+	deadLetterMutex.Lock()
+	defer deadLetterMutex.Unlock()
+
+	entries, err := readDeadLetters(path)
+	if err != nil {
+		return result, err
+	}
+
+	selected := idSet(ids)
+	var kept []DeadLetter
+	for _, entry := range entries {
+		if !matches(selected, entry.ID) {
+			kept = append(kept, entry)
+			continue
+		}
+
+		j := job{event: entry.Event, kind: entry.Type, target: hc.currentTarget(entry.Event, entry.Type), payload: entry.Payload, clientIP: entry.ClientIP}
+		if j.kind == kindWebhook {
+			if j.target != entry.Target {
+				j.target = ""
+			}
+			j.auth = hc.webhookAuth(j.event)
+		}
+		if j.target == "" {
+			logger.Logf(types.LogWarn, "Not replaying dead-lettered %s %s %s, the hook is no longer configured with that target", entry.Event, entry.Type, entry.ID)
+			result.Stale = append(result.Stale, entry.ID)
+			kept = append(kept, entry)
+			continue
+		}
+		if !enqueue(j) {
+			kept = append(kept, entry)
+			continue
+		}
+		logger.Logf(types.LogInfo, "Replaying dead-lettered %s %s %s", entry.Event, entry.Type, entry.ID)
+		result.Replayed++
+	}
+
+	result.Remaining = len(kept)
+	if result.Replayed > 0 {
+		if err := writeDeadLetters(path, kept); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// DeleteDeadLetters removes the entries with the given IDs, or every entry
+// when ids is empty, and returns how many were removed
+func DeleteDeadLetters(ids []string) (int, error) {
+	path, err := deadLetterPath()
+	if err != nil {
+		return 0, err
+	}
+
+	deadLetterMutex.Lock()
+	defer deadLetterMutex.Unlock()
+
+	entries, err := readDeadLetters(path)
+	if err != nil {
+		return 0, err
+	}
+
+	selected := idSet(ids)
+	var kept []DeadLetter
+	for _, entry := range entries {
+		if !matches(selected, entry.ID) {
+			kept = append(kept, entry)
+		}
+	}
+
+	deleted := len(entries) - len(kept)
+	if deleted > 0 {
+		if err := writeDeadLetters(path, kept); err != nil {
+			return 0, err
+		}
+		logger.Logf(types.LogInfo, "Deleted %d dead-lettered hook runs", deleted)
+	}
+	return deleted, nil
+}
+
+// deadLetterPath returns the configured dead-letter file
+func deadLetterPath() (string, error) {
+	dispatchMutex.Lock()
+	defer dispatchMutex.Unlock()
+
+	if dispatch.DeadLetterFile == "" {
+		return "", ErrNoDeadLetterFile
+	}
+	return dispatch.DeadLetterFile, nil
+}
+
+// appendDeadLetter appends one entry to the dead-letter file
+func appendDeadLetter(path string, entry DeadLetter) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode dead letter: %v", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open dead-letter file: %v", err)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write dead-letter file: %v", err)
+	}
+	return file.Close()
+}
+
+// readDeadLetters parses the dead-letter file; a missing file has no
+// entries and unreadable lines are skipped with a warning
+func readDeadLetters(path string) ([]DeadLetter, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead-letter file: %v", err)
+	}
+
+	var entries []DeadLetter
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			logger.Logf(types.LogWarn, "Skipping invalid dead-letter entry on line %d: %v", line, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// writeDeadLetters atomically replaces the dead-letter file with entries
+func writeDeadLetters(path string, entries []DeadLetter) error {
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode dead letter: %v", err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".dead-letters-*")
+	if err != nil {
+		return fmt.Errorf("failed to write dead-letter file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write dead-letter file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write dead-letter file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace dead-letter file: %v", err)
+	}
+	return nil
+}
+
+// newDeadLetterID returns a random identifier for a dead-letter entry
+func newDeadLetterID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
+
+// idSet returns the given IDs as a set; nil selects every entry
+func idSet(ids []string) map[string]bool {
+	if len(ids) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+// matches reports whether id is selected by set
+func matches(set map[string]bool, id string) bool {
+	return set == nil || set[id]
+}
@@ -0,0 +1,327 @@
+package hooks
+
+import (
+	"errors"
+	mathrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/metrics"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/options"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// ErrQueueFull is returned when a hook run was dropped because its queue
+// was full or the dispatcher is draining for shutdown
+var ErrQueueFull = errors.New("hook queue full, event dropped")
+
+// maxRetryBackoff caps the delay between webhook retries
+const maxRetryBackoff = 5 * time.Minute
+
+// DispatchConfig bounds asynchronous hook execution. Every hook (the
+// onReceive and onSend webhook and command) has its own queue of up to
+// QueueSize waiting runs and at most Concurrency runs in flight.
+// DrainTimeout bounds how long shutdown waits for queued runs; zero waits
+// until they have all finished. Failed webhooks are retried up to Retries
+// times, starting RetryBackoff apart, before being written to
+// DeadLetterFile.
+type DispatchConfig struct {
+	QueueSize      int
+	Concurrency    int
+	DrainTimeout   time.Duration
+	Retries        int
+	RetryBackoff   time.Duration
+	DeadLetterFile string
+}
+
+// job is one queued hook run
+type job struct {
+	event    string
+	kind     string
+	target   string
+	auth     *WebhookAuth
+	payload  []byte
+	clientIP string
+	queuedAt time.Time
+}
+
+// hookQueue holds the waiting runs and counters of one hook
+type hookQueue struct {
+	status types.HookQueueStatus
+	jobs   []job
+}
+
+// Dispatcher state. Queues are created on first use and kept for the
+// lifetime of the process so their counters survive reloads.
+var (
+	dispatch      = DispatchConfig{QueueSize: 100, Concurrency: 2, DrainTimeout: 30 * time.Second, Retries: 3, RetryBackoff: time.Second}
+	queues        = make(map[string]*hookQueue)
+	queueOrder    []string
+	draining      bool
+	drainStarted  = make(chan struct{})
+	dispatchMutex sync.Mutex
+	dispatchIdle  = sync.NewCond(&dispatchMutex)
+)
+
+// GetDispatchConfig reads the dispatcher settings from the current options
+func GetDispatchConfig() DispatchConfig {
+	config := DispatchConfig{
+		QueueSize:    options.Int("HOOK_QUEUE_SIZE", 100),
+		Concurrency:  options.Int("HOOK_CONCURRENCY", 2),
+		DrainTimeout: time.Duration(options.Int("HOOK_DRAIN_TIMEOUT", 30)) * time.Second,
+		Retries:      options.Int("HOOK_RETRIES", 3),
+		// Milliseconds so tests and fast receivers can use short delays
+		RetryBackoff:   time.Duration(options.Int("HOOK_RETRY_BACKOFF", 1000)) * time.Millisecond,
+		DeadLetterFile: options.Get("HOOK_DEAD_LETTER_FILE"),
+	}
+	if config.QueueSize < 1 {
+		logger.Logln(types.LogWarn, "HOOK_QUEUE_SIZE must be at least 1, using 1")
+		config.QueueSize = 1
+	}
+	if config.Concurrency < 1 {
+		logger.Logln(types.LogWarn, "HOOK_CONCURRENCY must be at least 1, using 1")
+		config.Concurrency = 1
+	}
+	return config
+}
+
+// SetDispatch applies dispatcher limits. A smaller queue keeps runs that
+// are already waiting; a higher concurrency starts workers for them.
+func SetDispatch(config DispatchConfig) {
+	dispatchMutex.Lock()
+	defer dispatchMutex.Unlock()
+
+	dispatch = config
+	for _, key := range queueOrder {
+		startWorkers(queues[key])
+	}
+}
+
+// enqueue queues a hook run, returning false when it was dropped
+func enqueue(j job) bool {
+	dispatchMutex.Lock()
+	defer dispatchMutex.Unlock()
+
+	key := j.event + " " + j.kind
+	q, ok := queues[key]
+	if !ok {
+		q = &hookQueue{status: types.HookQueueStatus{Event: j.event, Type: j.kind}}
+		queues[key] = q
+		queueOrder = append(queueOrder, key)
+	}
+
+	if draining || len(q.jobs) >= dispatch.QueueSize {
+		q.status.Dropped++
+		metrics.HookDropped.Inc(j.event, j.kind)
+		reason := "queue full"
+		if draining {
+			reason = "shutting down"
+		}
+		logger.WithFields(types.LogFields{"client_ip": j.clientIP}).Logf(types.LogWarn, "Dropped %s %s for %s (%s, %d dropped so far)", j.event, j.kind, j.clientIP, reason, q.status.Dropped)
+		return false
+	}
+
+	j.queuedAt = time.Now()
+	q.jobs = append(q.jobs, j)
+	q.status.Queued = len(q.jobs)
+	metrics.HookQueueDepth.Set(float64(len(q.jobs)), j.event, j.kind)
+	startWorkers(q)
+	return true
+}
+
+// startWorkers starts workers for waiting runs up to the concurrency
+// limit; the caller must hold dispatchMutex
+func startWorkers(q *hookQueue) {
+	for q.status.Active < dispatch.Concurrency && q.status.Active < len(q.jobs) {
+		q.status.Active++
+		go work(q)
+	}
+}
+
+// work runs queued jobs until the queue is empty or the concurrency limit
+// was lowered below the number of running workers
+func work(q *hookQueue) {
+	dispatchMutex.Lock()
+	for len(q.jobs) > 0 && q.status.Active <= dispatch.Concurrency {
+		j := q.jobs[0]
+		q.jobs = q.jobs[1:]
+		q.status.Queued = len(q.jobs)
+		metrics.HookQueueDepth.Set(float64(len(q.jobs)), j.event, j.kind)
+		dispatchMutex.Unlock()
+
+		err := run(q, j)
+
+		dispatchMutex.Lock()
+		if err != nil {
+			q.status.Failed++
+		} else {
+			q.status.Completed++
+		}
+	}
+	q.status.Active--
+	dispatchIdle.Broadcast()
+	dispatchMutex.Unlock()
+}
+
+// run executes one hook and records its outcome. Webhooks that fail with a
+// timeout, connection error or 5xx status are retried with exponential
+// backoff; a webhook that is rejected (4xx) or runs out of retries is
+// written to the dead-letter file.
+func run(q *hookQueue, j job) error {
+	jobLogger := logger.WithFields(types.LogFields{"client_ip": j.clientIP})
+	jobLogger.Logf(types.LogDebug, "Executing %s %s for client %s after %v in queue", j.event, j.kind, j.clientIP, time.Since(j.queuedAt).Round(time.Millisecond))
+	metrics.HookExecutions.Inc(j.event)
+
+	if j.kind == kindCommand {
+		if err := executeCommand(j.target, j.payload, j.event); err != nil {
+			jobLogger.Logf(types.LogWarn, "%s command failed: %v", j.event, err)
+			metrics.HookFailures.Inc(j.event)
+			return err
+		}
+		jobLogger.Logf(types.LogInfo, "Successfully executed %s command for %s", j.event, j.clientIP)
+		return nil
+	}
+
+	dispatchMutex.Lock()
+	retries, backoff := dispatch.Retries, dispatch.RetryBackoff
+	dispatchMutex.Unlock()
+
+	for attempt := 1; ; attempt++ {
+		err := executeWebhook(j.target, j.payload, j.event, j.auth)
+		if err == nil {
+			jobLogger.Logf(types.LogInfo, "Successfully executed %s webhook for %s (attempt %d)", j.event, j.clientIP, attempt)
+			return nil
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt > retries {
+			jobLogger.Logf(types.LogWarn, "%s webhook failed after %d attempt(s): %v", j.event, attempt, err)
+			metrics.HookFailures.Inc(j.event)
+			deadLetter(q, j, attempt, err)
+			return err
+		}
+
+		delay := retryDelay(backoff, attempt)
+		jobLogger.Logf(types.LogWarn, "%s webhook attempt %d failed, retrying in %v: %v", j.event, attempt, delay.Round(time.Millisecond), err)
+		metrics.HookRetries.Inc(j.event)
+		dispatchMutex.Lock()
+		q.status.Retried++
+		dispatchMutex.Unlock()
+
+		select {
+		case <-time.After(delay):
+		case <-drainStarted:
+			// Shutting down: keep the event instead of waiting out the backoff
+			jobLogger.Logf(types.LogWarn, "%s webhook not retried during shutdown: %v", j.event, err)
+			metrics.HookFailures.Inc(j.event)
+			deadLetter(q, j, attempt, err)
+			return err
+		}
+	}
+}
+
+// retryDelay returns the wait before retry number attempt: the backoff
+// doubled per attempt, capped, with the upper half randomized so failed
+// events do not all retry at the same moment
+func retryDelay(backoff time.Duration, attempt int) time.Duration {
+	delay := backoff
+	for i := 1; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff {
+		delay = maxRetryBackoff
+	}
+	if delay <= 1 {
+		return delay
+	}
+	half := delay / 2
+	return half + time.Duration(mathrand.Int63n(int64(delay-half)+1))
+}
+
+// Drain stops accepting hook runs and waits for queued and running ones to
+// finish, up to the configured DrainTimeout. It returns the number of runs
+// abandoned when the timeout expired.
+func Drain() int {
+	dispatchMutex.Lock()
+	if !draining {
+		draining = true
+		close(drainStarted)
+	}
+	timeout := dispatch.DrainTimeout
+	pending := pendingRuns()
+	dispatchMutex.Unlock()
+
+	if pending == 0 {
+		return 0
+	}
+	logger.Logf(types.LogInfo, "Waiting for %d queued hook run(s) to finish", pending)
+
+	done := make(chan struct{})
+	go func() {
+		dispatchMutex.Lock()
+		for pendingRuns() > 0 {
+			dispatchIdle.Wait()
+		}
+		dispatchMutex.Unlock()
+		close(done)
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-done:
+		logger.Logln(types.LogInfo, "All hook runs finished")
+		return 0
+	case <-expired:
+	}
+
+	dispatchMutex.Lock()
+	abandoned := pendingRuns()
+	unstarted := make(map[*hookQueue][]job)
+	for _, key := range queueOrder {
+		q := queues[key]
+		unstarted[q] = q.jobs
+		q.status.Dropped += uint64(len(q.jobs))
+		metrics.HookDropped.Add(float64(len(q.jobs)), q.status.Event, q.status.Type)
+		q.jobs = nil
+		q.status.Queued = 0
+		metrics.HookQueueDepth.Set(0, q.status.Event, q.status.Type)
+	}
+	dispatchMutex.Unlock()
+	logger.Logf(types.LogWarn, "Hook runs did not finish within %v, abandoning %d", timeout, abandoned)
+
+	// Runs that never started are kept in the dead-letter file for replay
+	for q, jobs := range unstarted {
+		for _, j := range jobs {
+			deadLetter(q, j, 0, errors.New("not run before shutdown"))
+		}
+	}
+	return abandoned
+}
+
+// pendingRuns counts waiting and running hook runs; the caller must hold
+// dispatchMutex
+func pendingRuns() int {
+	pending := 0
+	for _, q := range queues {
+		pending += len(q.jobs) + q.status.Active
+	}
+	return pending
+}
+
+// QueueStatus returns the counters of every hook queue used so far
+func QueueStatus() []types.HookQueueStatus {
+	dispatchMutex.Lock()
+	defer dispatchMutex.Unlock()
+
+	status := make([]types.HookQueueStatus, 0, len(queueOrder))
+	for _, key := range queueOrder {
+		status = append(status, queues[key].status)
+	}
+	return status
+}
@@ -0,0 +1,34 @@
+package hooks
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		backoff  time.Duration
+		attempt  int
+		min, max time.Duration
+	}{
+		{"first retry", time.Second, 1, 500 * time.Millisecond, time.Second},
+		{"doubles per attempt", time.Second, 3, 2 * time.Second, 4 * time.Second},
+		{"capped", time.Second, 20, maxRetryBackoff / 2, maxRetryBackoff},
+		{"backoff above cap", time.Hour, 1, maxRetryBackoff / 2, maxRetryBackoff},
+		{"zero backoff", 0, 3, 0, 0},
+		{"one nanosecond", 1, 1, 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The upper half is random, so check the bounds repeatedly
+			for i := 0; i < 100; i++ {
+				delay := retryDelay(tt.backoff, tt.attempt)
+				if delay < tt.min || delay > tt.max {
+					t.Fatalf("retryDelay(%v, %d) = %v, want between %v and %v", tt.backoff, tt.attempt, delay, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
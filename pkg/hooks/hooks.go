@@ -5,123 +5,157 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
 	"os/exec"
-	"strings"
 	"time"
 
 	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/logging"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/options"
 	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
 )
 
+// logger tags this package's log records with the hooks component
+var logger = logging.Component("hooks")
+
 // HookConfig holds webhook configuration.
 type HookConfig struct {
-	OnReceiveURL string
-	OnReceiveCmd string
-	OnSendURL    string
-	OnSendCmd    string
+	OnReceiveURL  string
+	OnReceiveCmd  string
+	OnReceiveAuth *WebhookAuth
+	OnSendURL     string
+	OnSendCmd     string
+	OnSendAuth    *WebhookAuth
 }
 
-// LoadHookConfig loads hook configuration from environment variables.
-func LoadHookConfig() *HookConfig {
+// LoadHookConfig loads hook configuration from environment variables or
+// flags, reading secret values from their files.
+func LoadHookConfig() (*HookConfig, error) {
+	onReceiveAuth, err := loadWebhookAuth("HOOK_ON_RECEIVE")
+	if err != nil {
+		return nil, err
+	}
+	onSendAuth, err := loadWebhookAuth("HOOK_ON_SEND")
+	if err != nil {
+		return nil, err
+	}
+
 	return &HookConfig{
-		OnReceiveURL: os.Getenv("HOOK_ON_RECEIVE_URL"),
-		OnReceiveCmd: os.Getenv("HOOK_ON_RECEIVE_CMD"),
-		OnSendURL:    os.Getenv("HOOK_ON_SEND_URL"),
-		OnSendCmd:    os.Getenv("HOOK_ON_SEND_CMD"),
+		OnReceiveURL:  options.Get("HOOK_ON_RECEIVE_URL"),
+		OnReceiveCmd:  options.Get("HOOK_ON_RECEIVE_CMD"),
+		OnReceiveAuth: onReceiveAuth,
+		OnSendURL:     options.Get("HOOK_ON_SEND_URL"),
+		OnSendCmd:     options.Get("HOOK_ON_SEND_CMD"),
+		OnSendAuth:    onSendAuth,
+	}, nil
+}
+
+// currentTarget returns the URL or command currently configured for an
+// event's hook of the given kind
+func (hc *HookConfig) currentTarget(event, kind string) string {
+	switch {
+	case event == "onReceive" && kind == kindWebhook:
+		return hc.OnReceiveURL
+	case event == "onReceive" && kind == kindCommand:
+		return hc.OnReceiveCmd
+	case event == "onSend" && kind == kindWebhook:
+		return hc.OnSendURL
+	case event == "onSend" && kind == kindCommand:
+		return hc.OnSendCmd
+	}
+	return ""
+}
+
+// webhookAuth returns the header and signing settings of an event's webhook
+func (hc *HookConfig) webhookAuth(event string) *WebhookAuth {
+	if event == "onSend" {
+		return hc.OnSendAuth
 	}
+	return hc.OnReceiveAuth
 }
 
 // OnReceivePayload contains data sent to onReceive hooks.
 type OnReceivePayload struct {
-	Timestamp   time.Time `json:"timestamp"`
-	ClientIP    string    `json:"client_ip"`
-	ClientPort  int       `json:"client_port"`
-	Message     string    `json:"message"`
-	LocalSocket string    `json:"local_socket"`
+	Timestamp      time.Time `json:"timestamp"`
+	ClientIP       string    `json:"client_ip"`
+	ClientPort     int       `json:"client_port"`
+	ClientMAC      string    `json:"client_mac"`
+	ClientHostname string    `json:"client_hostname"`
+	ClientName     string    `json:"client_name"`
+	Message        string    `json:"message"`
+	LocalSocket    string    `json:"local_socket"`
 }
 
 // OnSendPayload contains data sent to onSend hooks.
 type OnSendPayload struct {
-	Timestamp     time.Time `json:"timestamp"`
-	ClientIP      string    `json:"client_ip"`
-	ClientPort    int       `json:"client_port"`
-	ServerID      string    `json:"server_id"`
-	ServerName    string    `json:"server_name"`
-	AddressURL    string    `json:"address_url"`
-	ResponseBytes int       `json:"response_bytes"`
+	Timestamp      time.Time `json:"timestamp"`
+	ClientIP       string    `json:"client_ip"`
+	ClientPort     int       `json:"client_port"`
+	ClientMAC      string    `json:"client_mac"`
+	ClientHostname string    `json:"client_hostname"`
+	ClientName     string    `json:"client_name"`
+	ServerID       string    `json:"server_id"`
+	ServerName     string    `json:"server_name"`
+	AddressURL     string    `json:"address_url"`
+	ResponseBytes  int       `json:"response_bytes"`
 }
 
-// ExecuteOnReceive executes configured onReceive hooks.
-func (hc *HookConfig) ExecuteOnReceive(payload OnReceivePayload) error {
-	if hc.OnReceiveURL == "" && hc.OnReceiveCmd == "" {
-		logging.Logf(types.LogDebug, "No onReceive hook configured, skipping")
-		return nil
-	}
-
-	logging.Logf(types.LogDebug, "Executing onReceive hook for client %s", payload.ClientIP)
-
-	if hc.OnReceiveURL != "" {
-		if err := executeWebhook(hc.OnReceiveURL, payload, "onReceive"); err != nil {
-			logging.Logf(types.LogWarn, "onReceive webhook failed: %v", err)
-			return err
-		}
-	}
-
-	if hc.OnReceiveCmd != "" {
-		if err := executeCommand(hc.OnReceiveCmd, payload, "onReceive"); err != nil {
-			logging.Logf(types.LogWarn, "onReceive command failed: %v", err)
-			return err
-		}
-	}
+// Hook kinds; each event can have one of each
+const (
+	kindWebhook = "webhook"
+	kindCommand = "command"
+)
 
-	logging.Logf(types.LogInfo, "Successfully executed onReceive hook for %s", payload.ClientIP)
-	return nil
+// ExecuteOnReceive queues the configured onReceive hooks. It returns
+// without waiting for them; ErrQueueFull reports a dropped run.
+func (hc *HookConfig) ExecuteOnReceive(payload OnReceivePayload) error {
+	return hc.dispatch("onReceive", hc.OnReceiveURL, hc.OnReceiveCmd, hc.OnReceiveAuth, payload, payload.ClientIP)
 }
 
-// ExecuteOnSend executes configured onSend hooks.
+// ExecuteOnSend queues the configured onSend hooks. It returns without
+// waiting for them, so a slow hook never delays a discovery response;
+// ErrQueueFull reports a dropped run.
 func (hc *HookConfig) ExecuteOnSend(payload OnSendPayload) error {
-	if hc.OnSendURL == "" && hc.OnSendCmd == "" {
-		logging.Logf(types.LogDebug, "No onSend hook configured, skipping")
-		return nil
-	}
-
-	logging.Logf(types.LogDebug, "Executing onSend hook for client %s", payload.ClientIP)
-
-	if hc.OnSendURL != "" {
-		if err := executeWebhook(hc.OnSendURL, payload, "onSend"); err != nil {
-			logging.Logf(types.LogWarn, "onSend webhook failed: %v", err)
-			return err
-		}
-	}
+	return hc.dispatch("onSend", hc.OnSendURL, hc.OnSendCmd, hc.OnSendAuth, payload, payload.ClientIP)
+}
 
-	if hc.OnSendCmd != "" {
-		if err := executeCommand(hc.OnSendCmd, payload, "onSend"); err != nil {
-			logging.Logf(types.LogWarn, "onSend command failed: %v", err)
-			return err
-		}
+// dispatch marshals the payload once and queues a run for the webhook and
+// command of an event, whichever are configured
+func (hc *HookConfig) dispatch(event, url, command string, auth *WebhookAuth, payload interface{}, clientIP string) error {
+	if url == "" && command == "" {
+		logger.Logf(types.LogDebug, "No %s hook configured, skipping", event)
+		return nil
 	}
 
-	logging.Logf(types.LogInfo, "Successfully executed onSend hook for %s", payload.ClientIP)
-	return nil
-}
-
-// executeWebhook sends a POST request with JSON payload to the webhook URL.
-func executeWebhook(url string, payload interface{}, hookName string) error {
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
+		logger.Logf(types.LogWarn, "%s hook payload could not be encoded: %v", event, err)
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
-	logging.Logf(types.LogDebug, "Sending %s webhook to %s with payload: %s", hookName, url, string(jsonData))
+	logger.Logf(types.LogDebug, "Queueing %s hook for client %s", event, clientIP)
+	var dropped error
+	if url != "" && !enqueue(job{event: event, kind: kindWebhook, target: url, auth: auth, payload: jsonData, clientIP: clientIP}) {
+		dropped = ErrQueueFull
+	}
+	if command != "" && !enqueue(job{event: event, kind: kindCommand, target: command, payload: jsonData, clientIP: clientIP}) {
+		dropped = ErrQueueFull
+	}
+	return dropped
+}
+
+// executeWebhook sends a POST request with JSON payload to the webhook URL,
+// adding the configured headers, bearer token and signature.
+func executeWebhook(url string, jsonData []byte, hookName string, auth *WebhookAuth) error {
+	logger.Logf(types.LogDebug, "Sending %s webhook to %s with payload: %s", hookName, url, string(jsonData))
 
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		// A malformed URL fails the same way on every attempt
+		return &permanentError{err: fmt.Errorf("failed to create request: %w", err)}
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "jellyfin-discovery-proxy/"+types.Version)
+	auth.apply(req, jsonData, time.Now())
 
 	client := &http.Client{
 		Timeout: 10 * time.Second,
@@ -133,44 +167,58 @@ func executeWebhook(url string, payload interface{}, hookName string) error {
 	}
 	defer resp.Body.Close()
 
-	logging.Logf(types.LogDebug, "%s webhook responded with status: %d", hookName, resp.StatusCode)
+	logger.Logf(types.LogDebug, "%s webhook responded with status: %d", hookName, resp.StatusCode)
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("webhook returned non-2xx status: %d", resp.StatusCode)
+		err := fmt.Errorf("webhook returned non-2xx status: %d", resp.StatusCode)
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			// The receiver rejected the event; sending it again won't help
+			return &permanentError{err: err}
+		}
+		return err
 	}
 
 	return nil
 }
 
-// executeCommand executes a shell command with JSON payload passed via stdin.
-func executeCommand(command string, payload interface{}, hookName string) error {
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
-	}
+// permanentError marks a webhook failure that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+// Error implements error
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
 
-	logging.Logf(types.LogDebug, "Executing %s command: %s", hookName, command)
+// Unwrap returns the underlying error
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// executeCommand executes a shell command with JSON payload passed via stdin.
+func executeCommand(command string, jsonData []byte, hookName string) error {
+	logger.Logf(types.LogDebug, "Executing %s command: %s", hookName, command)
 
 	cmd := exec.Command("bash", "-c", command)
-	cmd.Stdin = strings.NewReader(string(jsonData))
+	cmd.Stdin = bytes.NewReader(jsonData)
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	err = cmd.Run()
+	err := cmd.Run()
 	if err != nil {
-		logging.Logf(types.LogError, "%s command failed: %v, stderr: %s", hookName, err, stderr.String())
+		logger.Logf(types.LogError, "%s command failed: %v, stderr: %s", hookName, err, stderr.String())
 		return fmt.Errorf("command execution failed: %w", err)
 	}
 
 	if stdout.Len() > 0 {
-		logging.Logf(types.LogDebug, "%s command stdout: %s", hookName, stdout.String())
+		logger.Logf(types.LogDebug, "%s command stdout: %s", hookName, stdout.String())
 	}
 	if stderr.Len() > 0 {
-		logging.Logf(types.LogDebug, "%s command stderr: %s", hookName, stderr.String())
+		logger.Logf(types.LogDebug, "%s command stderr: %s", hookName, stderr.String())
 	}
 
-	logging.Logf(types.LogInfo, "%s command executed successfully", hookName)
 	return nil
 }
@@ -0,0 +1,198 @@
+package logging
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/options"
+)
+
+// rotatedSuffix is the timestamp appended to rotated log files; it sorts
+// chronologically so the oldest backups are pruned first
+const rotatedSuffix = "20060102-150405.000"
+
+// FileConfig describes the optional log file and its rotation policy
+type FileConfig struct {
+	Path     string
+	MaxSize  int64
+	MaxAge   time.Duration
+	Backups  int
+	Compress bool
+}
+
+// RotatingFile is an io.Writer appending to a log file that is renamed
+// aside once it grows past MaxSize or gets older than MaxAge. Rotated files
+// are optionally gzipped and only the newest Backups are kept.
+type RotatingFile struct {
+	config   FileConfig
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	mutex    sync.Mutex
+	cleanup  sync.Mutex
+}
+
+// GetFileConfig reads the LOG_FILE options
+func GetFileConfig() FileConfig {
+	return FileConfig{
+		Path:     options.Get("LOG_FILE"),
+		MaxSize:  int64(options.Int("LOG_FILE_MAX_SIZE", 10)) * 1024 * 1024,
+		MaxAge:   time.Duration(options.Int("LOG_FILE_MAX_AGE", 0)) * time.Hour,
+		Backups:  options.Int("LOG_FILE_BACKUPS", 5),
+		Compress: options.Bool("LOG_FILE_COMPRESS", true),
+	}
+}
+
+// OpenRotatingFile opens (or creates) the log file for appending
+func OpenRotatingFile(config FileConfig) (*RotatingFile, error) {
+	rf := &RotatingFile{config: config}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// open opens the log file, continuing an existing one
+func (rf *RotatingFile) open() error {
+	if dir := filepath.Dir(rf.config.Path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create log directory '%s': %v", dir, err)
+		}
+	}
+
+	file, err := os.OpenFile(rf.config.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file '%s': %v", rf.config.Path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file '%s': %v", rf.config.Path, err)
+	}
+
+	rf.file = file
+	rf.size = info.Size()
+	rf.openedAt = time.Now()
+	return nil
+}
+
+// Write appends p to the log file, rotating first when it is due
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+
+	if rf.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	tooBig := rf.config.MaxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.config.MaxSize
+	tooOld := rf.config.MaxAge > 0 && time.Since(rf.openedAt) > rf.config.MaxAge
+	if tooBig || tooOld {
+		if err := rf.rotate(); err != nil {
+			// Keep writing to the current file rather than losing logs
+			fmt.Fprintf(os.Stderr, "log rotation failed: %v\n", err)
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// Close closes the log file
+func (rf *RotatingFile) Close() error {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+
+	if rf.file == nil {
+		return nil
+	}
+	err := rf.file.Close()
+	rf.file = nil
+	return err
+}
+
+// rotate renames the current file aside and starts a new one. Compression
+// and pruning run in the background so logging is not held up.
+func (rf *RotatingFile) rotate() error {
+	rotated := rf.config.Path + "." + time.Now().Format(rotatedSuffix)
+	if err := rf.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %v", err)
+	}
+	if err := os.Rename(rf.config.Path, rotated); err != nil {
+		// Reopen the original so logging continues
+		if openErr := rf.open(); openErr != nil {
+			rf.file = nil
+		}
+		return fmt.Errorf("failed to rename log file: %v", err)
+	}
+	if err := rf.open(); err != nil {
+		rf.file = nil
+		return err
+	}
+
+	go rf.finishRotation(rotated)
+	return nil
+}
+
+// finishRotation compresses the rotated file when configured and removes
+// backups beyond the retention count
+func (rf *RotatingFile) finishRotation(rotated string) {
+	rf.cleanup.Lock()
+	defer rf.cleanup.Unlock()
+
+	if rf.config.Compress {
+		if err := compressFile(rotated); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to compress rotated log file: %v\n", err)
+		}
+	}
+
+	backups, err := filepath.Glob(rf.config.Path + ".[0-9]*")
+	if err != nil {
+		return
+	}
+	sort.Strings(backups)
+	for len(backups) > rf.config.Backups {
+		if err := os.Remove(backups[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to remove old log file: %v\n", err)
+		}
+		backups = backups[1:]
+	}
+}
+
+// compressFile gzips path to path.gz and removes the original
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
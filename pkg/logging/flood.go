@@ -0,0 +1,149 @@
+package logging
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/options"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// floodSweepInterval is how often finished windows are checked for
+// suppressed messages to summarize
+const floodSweepInterval = time.Second
+
+// DedupConfig describes flood suppression: within each Window, only the
+// first Burst messages with the same template and client are logged and the
+// rest are summarized when the window ends. A zero Window disables it.
+type DedupConfig struct {
+	Window time.Duration
+	Burst  int
+}
+
+// floodEntry counts messages with one key during the current window
+type floodEntry struct {
+	windowStart time.Time
+	count       int
+	suppressed  int
+	last        types.LogRecord
+}
+
+// Flood suppression state
+var (
+	dedup      DedupConfig
+	floods     = make(map[string]*floodEntry)
+	floodMutex sync.Mutex
+	floodOnce  sync.Once
+)
+
+// GetDedupConfig reads the LOG_DEDUP options
+func GetDedupConfig() DedupConfig {
+	return DedupConfig{
+		Window: time.Duration(options.Int("LOG_DEDUP_WINDOW", 60)) * time.Second,
+		Burst:  options.Int("LOG_DEDUP_BURST", 5),
+	}
+}
+
+// SetDedup applies a flood suppression configuration, summarizing anything
+// suppressed under the previous one
+func SetDedup(config DedupConfig) {
+	floodMutex.Lock()
+	summaries := takeSummaries(func(*floodEntry) bool { return true })
+	dedup = config
+	floodMutex.Unlock()
+
+	for _, summary := range summaries {
+		emit(summary)
+	}
+	if config.Window > 0 {
+		floodOnce.Do(func() { go sweepFloods() })
+	}
+}
+
+// admit reports whether a record should be logged, counting it against the
+// flood window for its template and client. When the record starts a new
+// window after one that suppressed messages, that window's summary is
+// returned so it is logged first.
+func admit(template string, record types.LogRecord) (bool, *types.LogRecord) {
+	floodMutex.Lock()
+	defer floodMutex.Unlock()
+
+	if dedup.Window <= 0 {
+		return true, nil
+	}
+
+	key := strconv.Itoa(int(record.Level)) + "|" + record.Fields["component"] + "|" + record.Fields["client_ip"] + "|" + template
+	entry, ok := floods[key]
+	if !ok || record.Time.Sub(entry.windowStart) >= dedup.Window {
+		var summary *types.LogRecord
+		if ok && entry.suppressed > 0 {
+			s := summarize(entry)
+			summary = &s
+		}
+		floods[key] = &floodEntry{windowStart: record.Time, count: 1}
+		return true, summary
+	}
+
+	entry.count++
+	if entry.count <= dedup.Burst {
+		return true, nil
+	}
+	entry.suppressed++
+	entry.last = record
+	return false, nil
+}
+
+// sweepFloods periodically logs a summary for every window that ended with
+// suppressed messages and forgets finished windows
+func sweepFloods() {
+	ticker := time.NewTicker(floodSweepInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		floodMutex.Lock()
+		window := dedup.Window
+		summaries := takeSummaries(func(entry *floodEntry) bool {
+			return now.Sub(entry.windowStart) >= window
+		})
+		floodMutex.Unlock()
+
+		for _, summary := range summaries {
+			emit(summary)
+		}
+	}
+}
+
+// takeSummaries removes the entries selected by done and returns a summary
+// record for each that suppressed messages. The caller must hold floodMutex.
+func takeSummaries(done func(*floodEntry) bool) []types.LogRecord {
+	var summaries []types.LogRecord
+	for key, entry := range floods {
+		if !done(entry) {
+			continue
+		}
+		delete(floods, key)
+		if entry.suppressed == 0 {
+			continue
+		}
+
+		summaries = append(summaries, summarize(entry))
+	}
+	return summaries
+}
+
+// summarize builds the record reporting an entry's suppressed messages,
+// keeping the level and fields of the last one
+func summarize(entry *floodEntry) types.LogRecord {
+	summary := entry.last
+	summary.Time = time.Now()
+
+	elapsed := summary.Time.Sub(entry.windowStart)
+	if elapsed > dedup.Window {
+		elapsed = dedup.Window
+	}
+	summary.Message = fmt.Sprintf("Message repeated %d times in last %s: %s",
+		entry.suppressed, elapsed.Round(time.Second), entry.last.Message)
+	return summary
+}
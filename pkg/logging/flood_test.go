@@ -0,0 +1,102 @@
+package logging
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+func TestAdmit(t *testing.T) {
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	record := func(offset time.Duration, client string) types.LogRecord {
+		return types.LogRecord{
+			Time:    base.Add(offset),
+			Level:   types.LogWarn,
+			Message: "Ignoring request from " + client,
+			Fields:  types.LogFields{"component": "discovery", "client_ip": client},
+		}
+	}
+
+	type call struct {
+		record      types.LogRecord
+		wantLogged  bool
+		wantSummary string
+	}
+	tests := []struct {
+		name   string
+		config DedupConfig
+		calls  []call
+	}{
+		{
+			name:   "disabled",
+			config: DedupConfig{},
+			calls: []call{
+				{record(0, "10.0.0.1"), true, ""},
+				{record(0, "10.0.0.1"), true, ""},
+				{record(0, "10.0.0.1"), true, ""},
+			},
+		},
+		{
+			name:   "burst then suppressed",
+			config: DedupConfig{Window: time.Minute, Burst: 2},
+			calls: []call{
+				{record(0, "10.0.0.1"), true, ""},
+				{record(time.Second, "10.0.0.1"), true, ""},
+				{record(2*time.Second, "10.0.0.1"), false, ""},
+				{record(3*time.Second, "10.0.0.1"), false, ""},
+			},
+		},
+		{
+			name:   "clients counted separately",
+			config: DedupConfig{Window: time.Minute, Burst: 1},
+			calls: []call{
+				{record(0, "10.0.0.1"), true, ""},
+				{record(0, "10.0.0.2"), true, ""},
+				{record(time.Second, "10.0.0.1"), false, ""},
+			},
+		},
+		{
+			name:   "next window summarizes the last",
+			config: DedupConfig{Window: time.Minute, Burst: 1},
+			calls: []call{
+				{record(0, "10.0.0.1"), true, ""},
+				{record(time.Second, "10.0.0.1"), false, ""},
+				{record(2*time.Second, "10.0.0.1"), false, ""},
+				{record(time.Minute, "10.0.0.1"), true, "Message repeated 2 times"},
+			},
+		},
+	}
+
+	t.Cleanup(func() {
+		floodMutex.Lock()
+		dedup = DedupConfig{}
+		floods = make(map[string]*floodEntry)
+		floodMutex.Unlock()
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			floodMutex.Lock()
+			dedup = tt.config
+			floods = make(map[string]*floodEntry)
+			floodMutex.Unlock()
+
+			for i, c := range tt.calls {
+				logged, summary := admit("Ignoring request from %s", c.record)
+				if logged != c.wantLogged {
+					t.Errorf("call %d: logged = %v, want %v", i, logged, c.wantLogged)
+				}
+				switch {
+				case c.wantSummary == "" && summary != nil:
+					t.Errorf("call %d: unexpected summary %q", i, summary.Message)
+				case c.wantSummary != "" && summary == nil:
+					t.Errorf("call %d: missing summary", i)
+				case c.wantSummary != "" && !strings.HasPrefix(summary.Message, c.wantSummary):
+					t.Errorf("call %d: summary = %q, want prefix %q", i, summary.Message, c.wantSummary)
+				}
+			}
+		})
+	}
+}
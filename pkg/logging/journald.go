@@ -0,0 +1,134 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// JournaldSocket is the systemd journal's native protocol socket
+var JournaldSocket = "/run/systemd/journal/socket"
+
+// journaldMaxDatagram keeps every record within the default socket send
+// buffer; longer messages are truncated rather than failing with EMSGSIZE
+const journaldMaxDatagram = 128 * 1024
+
+// journaldTruncated is appended to a message cut to fit one datagram
+const journaldTruncated = "... (truncated)"
+
+// JournaldSink sends records to the systemd journal using its native
+// protocol, so record fields become journal fields (client_ip becomes
+// CLIENT_IP) that journalctl can match on. Records are sent from a
+// sinkQueue so a stalled journal never blocks logging.
+type JournaldSink struct {
+	conn       net.Conn
+	identifier string
+	queue      *sinkQueue
+}
+
+// NewJournaldSink connects to the journal socket
+func NewJournaldSink(socket string) (*JournaldSink, error) {
+	conn, err := net.Dial("unixgram", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journald at %s: %v", socket, err)
+	}
+	sink := &JournaldSink{
+		conn:       conn,
+		identifier: filepath.Base(os.Args[0]),
+	}
+	sink.queue = newSinkQueue(sink.send, func() { conn.Close() })
+	return sink, nil
+}
+
+// Name identifies the sink in error messages
+func (js *JournaldSink) Name() string {
+	return "journald"
+}
+
+// Write queues one record as a single datagram; it never blocks
+func (js *JournaldSink) Write(record types.LogRecord) error {
+	var fields bytes.Buffer
+	writeJournalField(&fields, "PRIORITY", strconv.Itoa(syslogSeverity(record.Level)))
+	writeJournalField(&fields, "SYSLOG_IDENTIFIER", js.identifier)
+	for key, value := range record.Fields {
+		if name := journalFieldName(key); name != "" {
+			writeJournalField(&fields, name, value)
+		}
+	}
+
+	// Leave room for the field name, length prefix and newlines
+	message := record.Message
+	if room := journaldMaxDatagram - fields.Len() - 32; len(message) > room {
+		cut := room - len(journaldTruncated)
+		if cut < 0 {
+			cut = 0
+		}
+		message = strings.ToValidUTF8(message[:cut], "") + journaldTruncated
+	}
+
+	var b bytes.Buffer
+	writeJournalField(&b, "MESSAGE", message)
+	b.Write(fields.Bytes())
+	js.queue.push(b.Bytes())
+	return nil
+}
+
+// send writes one datagram. Failures go to stderr because logging them
+// would loop back into this sink.
+func (js *JournaldSink) send(datagram []byte) {
+	if dropped := js.queue.dropped.Swap(0); dropped > 0 {
+		fmt.Fprintf(os.Stderr, "log output %s dropped %d record(s)\n", js.Name(), dropped)
+	}
+
+	js.conn.SetWriteDeadline(time.Now().Add(sinkWriteTimeout))
+	if _, err := js.conn.Write(datagram); err != nil {
+		fmt.Fprintf(os.Stderr, "log output %s failed: %v\n", js.Name(), err)
+	}
+}
+
+// Close stops the sink after the queued records were sent
+func (js *JournaldSink) Close() error {
+	js.queue.close()
+	return nil
+}
+
+// writeJournalField appends one field. Values containing newlines use the
+// length-prefixed binary form of the protocol.
+func writeJournalField(b *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		b.WriteString(name + "=" + value + "\n")
+		return
+	}
+	b.WriteString(name + "\n")
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value + "\n")
+}
+
+// journalFieldName converts a record field key to a valid journal field
+// name: uppercase letters, digits and underscores, not starting with an
+// underscore (those are reserved for trusted fields)
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+	name = strings.TrimLeft(name, "_0123456789")
+	if name == "" || name == "MESSAGE" || name == "PRIORITY" || name == "SYSLOG_IDENTIFIER" {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,191 @@
+package logging
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// Components lists the parts of the proxy that can be given their own log
+// level with LOG_LEVELS
+var Components = []string{"discovery", "upstream", "hooks", "web", "auth", "config"}
+
+// Active and configured levels. The configured levels are what LOG_LEVEL
+// and LOG_LEVELS asked for; the active ones can be changed at runtime and
+// are restored from the configured ones by ResetLevels.
+var (
+	globalLevel          = types.LogInfo
+	componentLevels      = make(map[string]types.Log)
+	configuredLevel      = types.LogInfo
+	configuredComponents = make(map[string]types.Log)
+	levelsMutex          sync.RWMutex
+)
+
+// shouldLog determines if a message from component at the given level
+// should be logged
+func shouldLog(component string, level types.Log) bool {
+	levelsMutex.RLock()
+	defer levelsMutex.RUnlock()
+
+	if componentLevel, ok := componentLevels[component]; ok {
+		return level >= componentLevel
+	}
+	return level >= globalLevel
+}
+
+// Level returns the global log level
+func Level() types.Log {
+	levelsMutex.RLock()
+	defer levelsMutex.RUnlock()
+
+	return globalLevel
+}
+
+// SetLog parses and sets the global log level from a string
+func SetLog(level string) {
+	parsed, ok := ParseLevel(level)
+
+	levelsMutex.Lock()
+	globalLevel = parsed
+	levelsMutex.Unlock()
+
+	if !ok {
+		Logln(types.LogWarn, fmt.Sprintf("Unknown log level '%s', defaulting to 'info'", level))
+	}
+}
+
+// ConfigureLevels sets the global level and per-component levels from
+// LOG_LEVEL and LOG_LEVELS ("discovery=debug,hooks=warn"), replacing any
+// runtime changes. Invalid entries are logged and skipped.
+func ConfigureLevels(global, spec string) {
+	SetLog(global)
+
+	components := make(map[string]types.Log)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, levelStr, found := strings.Cut(entry, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		level, ok := ParseLevel(strings.TrimSpace(levelStr))
+		if !found || !ok || !isComponent(name) {
+			Logf(types.LogWarn, "Invalid LOG_LEVELS entry: %s, expected component=level with component one of %s", entry, strings.Join(Components, ", "))
+			continue
+		}
+		components[name] = level
+	}
+
+	levelsMutex.Lock()
+	defer levelsMutex.Unlock()
+
+	componentLevels = components
+	configuredLevel = globalLevel
+	configuredComponents = make(map[string]types.Log, len(components))
+	for name, level := range components {
+		configuredComponents[name] = level
+	}
+}
+
+// SetLevel changes a level at runtime. component is one of Components or
+// "global"; for a component, level "default" removes its override so it
+// follows the global level again.
+func SetLevel(component, level string) error {
+	component = strings.ToLower(component)
+	if component != "global" && !isComponent(component) {
+		return fmt.Errorf("unknown component '%s', expected global or one of %s", component, strings.Join(Components, ", "))
+	}
+
+	levelsMutex.Lock()
+	if component != "global" && strings.EqualFold(level, "default") {
+		delete(componentLevels, component)
+	} else {
+		parsed, ok := ParseLevel(level)
+		if !ok {
+			levelsMutex.Unlock()
+			return fmt.Errorf("unknown level '%s', expected debug, info, warn or error", level)
+		}
+		if component == "global" {
+			globalLevel = parsed
+		} else {
+			componentLevels[component] = parsed
+		}
+	}
+	levelsMutex.Unlock()
+
+	announce(fmt.Sprintf("Log level for %s set to %s", component, level))
+	return nil
+}
+
+// CycleLevel makes the global level one step more verbose, wrapping from
+// debug back to error, and drops component overrides so every component
+// follows it. It returns the new level.
+func CycleLevel() types.Log {
+	levelsMutex.Lock()
+	globalLevel--
+	if globalLevel < types.LogDebug {
+		globalLevel = types.LogError
+	}
+	componentLevels = make(map[string]types.Log)
+	level := globalLevel
+	levelsMutex.Unlock()
+
+	announce(fmt.Sprintf("Log level cycled to %s for all components", level.Name()))
+	return level
+}
+
+// ResetLevels restores the levels from LOG_LEVEL and LOG_LEVELS
+func ResetLevels() {
+	levelsMutex.Lock()
+	globalLevel = configuredLevel
+	componentLevels = make(map[string]types.Log, len(configuredComponents))
+	for name, level := range configuredComponents {
+		componentLevels[name] = level
+	}
+	levelsMutex.Unlock()
+
+	announce("Log levels reset to configured values")
+}
+
+// Levels describes the global level and the effective level of every
+// component
+func Levels() types.LogLevelsStatus {
+	levelsMutex.RLock()
+	defer levelsMutex.RUnlock()
+
+	status := types.LogLevelsStatus{
+		Global:     globalLevel.Name(),
+		Components: make(map[string]string, len(Components)),
+		Overrides:  []string{},
+	}
+	for _, name := range Components {
+		level, ok := componentLevels[name]
+		if !ok {
+			level = globalLevel
+		} else {
+			status.Overrides = append(status.Overrides, name)
+		}
+		status.Components[name] = level.Name()
+	}
+	sort.Strings(status.Overrides)
+	return status
+}
+
+// announce logs a level change regardless of the new levels, so the change
+// is always visible
+func announce(message string) {
+	write(types.LogWarn, nil, "", message)
+}
+
+// isComponent reports whether name is one of Components
+func isComponent(name string) bool {
+	for _, component := range Components {
+		if component == name {
+			return true
+		}
+	}
+	return false
+}
@@ -2,16 +2,24 @@ package logging
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/options"
 	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
 )
 
-// Global log level configuration
-var CurrentLog types.Log = types.LogInfo
+// jsonFormat selects JSON log lines instead of text. It is read on every
+// log call and changed by reloads, so it is accessed atomically.
+var jsonFormat atomic.Bool
+
+func init() {
+	options.Warnf = func(format string, v ...interface{}) {
+		Logf(types.LogWarn, format, v...)
+	}
+}
 
 // Global log buffer
 var LogBuffer *types.LogBuffer
@@ -19,79 +27,155 @@ var LogBuffer *types.LogBuffer
 // NewLogBuffer creates a new log buffer with specified max size
 func NewLogBuffer(maxSize int) *types.LogBuffer {
 	return &types.LogBuffer{
-		Messages: make([]string, 0, maxSize),
-		MaxSize:  maxSize,
+		Records: make([]types.LogRecord, 0, maxSize),
+		MaxSize: maxSize,
 	}
 }
 
-// SetLog parses and sets the global log level from a string
-func SetLog(level string) {
+// ParseLevel converts a level name to a log level
+func ParseLevel(level string) (types.Log, bool) {
 	switch strings.ToLower(level) {
 	case "debug":
-		CurrentLog = types.LogDebug
+		return types.LogDebug, true
 	case "info":
-		CurrentLog = types.LogInfo
+		return types.LogInfo, true
 	case "warn", "warning":
-		CurrentLog = types.LogWarn
+		return types.LogWarn, true
 	case "error":
-		CurrentLog = types.LogError
+		return types.LogError, true
 	default:
-		CurrentLog = types.LogInfo
-		Logln(types.LogWarn, fmt.Sprintf("Unknown log level '%s', defaulting to 'info'", level))
+		return types.LogInfo, false
 	}
 }
 
-// shouldLog determines if a message at the given level should be logged
-func shouldLog(level types.Log) bool {
-	return level >= CurrentLog
+// SetFormat sets the output format, "text" for human-readable lines or
+// "json" for one JSON object per line
+func SetFormat(format string) {
+	switch strings.ToLower(format) {
+	case "", "text":
+		jsonFormat.Store(false)
+	case "json":
+		jsonFormat.Store(true)
+	default:
+		jsonFormat.Store(false)
+		Logf(types.LogWarn, "Unknown log format '%s', defaulting to 'text'", format)
+	}
 }
 
 // Logf - Custom logging function with level prefix and timestamp
 func Logf(level types.Log, format string, v ...interface{}) {
-	if !shouldLog(level) {
+	if !shouldLog("", level) {
 		return
 	}
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	prefix := fmt.Sprintf("[%s] %s | ", timestamp, level.String())
-	formattedMsg := fmt.Sprintf(format, v...)
-	fullMsg := prefix + formattedMsg
-	log.Print(fullMsg)
-
-	// Add to buffer if available
-	if LogBuffer != nil {
-		LogBuffer.Add(fullMsg)
-	}
+	write(level, nil, format, fmt.Sprintf(format, v...))
 }
 
 // Logln - Custom logging function with level prefix for simple messages
 func Logln(level types.Log, message string) {
-	if !shouldLog(level) {
+	if !shouldLog("", level) {
 		return
 	}
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	prefix := fmt.Sprintf("[%s] %s | ", timestamp, level.String())
-	fullMsg := prefix + message
-	log.Println(fullMsg)
+	write(level, nil, message, message)
+}
+
+// Entry writes log records carrying a fixed set of fields, so every line
+// about one request can be found by its request_id or client_ip. An entry
+// created by Component is filtered by that component's log level.
+type Entry struct {
+	Fields    types.LogFields
+	component string
+}
+
+// WithFields returns an Entry that attaches fields to every record
+func WithFields(fields types.LogFields) *Entry {
+	return &Entry{Fields: fields}
+}
+
+// Component returns an Entry for one of Components, tagging its records
+// with a component field and filtering them by the component's level
+func Component(name string) *Entry {
+	return &Entry{Fields: types.LogFields{"component": name}, component: name}
+}
+
+// With returns a copy of the entry with one more field
+func (e *Entry) With(key, value string) *Entry {
+	return e.WithFields(types.LogFields{key: value})
+}
+
+// WithFields returns a copy of the entry with more fields
+func (e *Entry) WithFields(fields types.LogFields) *Entry {
+	merged := make(types.LogFields, len(e.Fields)+len(fields))
+	for k, v := range e.Fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &Entry{Fields: merged, component: e.component}
+}
+
+// Logf logs a formatted message with the entry's fields
+func (e *Entry) Logf(level types.Log, format string, v ...interface{}) {
+	if !shouldLog(e.component, level) {
+		return
+	}
+	write(level, e.Fields, format, fmt.Sprintf(format, v...))
+}
+
+// Logln logs a message with the entry's fields
+func (e *Entry) Logln(level types.Log, message string) {
+	if !shouldLog(e.component, level) {
+		return
+	}
+	write(level, e.Fields, message, message)
+}
+
+// write sends a record to every output and adds it to the buffer. template
+// is the format string the message was built from; repeats of the same
+// template for the same client are subject to flood suppression. An empty
+// template bypasses suppression.
+func write(level types.Log, fields types.LogFields, template, message string) {
+	record := types.LogRecord{
+		Time:    time.Now(),
+		Level:   level,
+		Message: message,
+		Fields:  fields,
+	}
+	if template != "" {
+		admitted, summary := admit(template, record)
+		if summary != nil {
+			emit(*summary)
+		}
+		if !admitted {
+			return
+		}
+	}
+	emit(record)
+}
+
+// emit sends a record to every output and adds it to the buffer
+func emit(record types.LogRecord) {
+	sinksMutex.RLock()
+	for _, sink := range sinks {
+		if err := sink.Write(record); err != nil {
+			// Logging the failure would recurse into the failing sink
+			fmt.Fprintf(os.Stderr, "log output %s failed: %v\n", sink.Name(), err)
+		}
+	}
+	sinksMutex.RUnlock()
 
 	// Add to buffer if available
 	if LogBuffer != nil {
-		LogBuffer.Add(fullMsg)
+		LogBuffer.Add(record)
 	}
 }
 
 // GetLogBufferSize parses the LOG_BUFFER_SIZE environment variable
 func GetLogBufferSize() int {
-	bufferSizeStr := os.Getenv("LOG_BUFFER_SIZE")
-	if bufferSizeStr == "" {
-		return 100 // Default buffer size
-	}
-
-	var bufferSize int
-	_, err := fmt.Sscanf(bufferSizeStr, "%d", &bufferSize)
-	if err != nil || bufferSize <= 0 {
-		Logf(types.LogWarn, "Invalid LOG_BUFFER_SIZE value: %s, using default 100", bufferSizeStr)
+	bufferSize := options.Int("LOG_BUFFER_SIZE", 100)
+	if bufferSize < 1 {
+		Logln(types.LogWarn, "LOG_BUFFER_SIZE must be at least 1, using default 100")
 		return 100
 	}
-
 	return bufferSize
 }
@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limits of the queue between a network sink and its sending goroutine
+const (
+	sinkQueueSize    = 1024
+	sinkWriteTimeout = 5 * time.Second
+)
+
+// sinkQueue hands encoded records to a background goroutine so a slow or
+// stalled destination never blocks logging. Records arriving while the
+// queue is full are dropped and counted.
+type sinkQueue struct {
+	messages chan []byte
+	closed   chan struct{}
+	done     chan struct{}
+	dropped  atomic.Uint64
+	once     sync.Once
+}
+
+// newSinkQueue starts a goroutine calling send for every queued message.
+// After close, the messages still queued are sent and then finish is
+// called.
+func newSinkQueue(send func([]byte), finish func()) *sinkQueue {
+	q := &sinkQueue{
+		messages: make(chan []byte, sinkQueueSize),
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go q.run(send, finish)
+	return q
+}
+
+// run sends queued messages until the queue is closed
+func (q *sinkQueue) run(send func([]byte), finish func()) {
+	defer close(q.done)
+	defer finish()
+
+	for {
+		select {
+		case message := <-q.messages:
+			send(message)
+		case <-q.closed:
+			for {
+				select {
+				case message := <-q.messages:
+					send(message)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// push queues one message; it never blocks
+func (q *sinkQueue) push(message []byte) {
+	select {
+	case <-q.closed:
+	case q.messages <- message:
+	default:
+		q.dropped.Add(1)
+	}
+}
+
+// close stops the queue after the queued messages were sent, waiting at
+// most sinkWriteTimeout
+func (q *sinkQueue) close() {
+	q.once.Do(func() { close(q.closed) })
+
+	select {
+	case <-q.done:
+	case <-time.After(sinkWriteTimeout):
+	}
+}
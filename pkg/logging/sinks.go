@@ -0,0 +1,148 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/options"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// Sink is a log output. Every record that passes the level filter is
+// written to every configured sink.
+type Sink interface {
+	Name() string
+	Write(record types.LogRecord) error
+	Close() error
+}
+
+// OutputConfig selects the sinks used in addition to stderr
+type OutputConfig struct {
+	File     FileConfig
+	Syslog   SyslogConfig
+	Journald bool
+}
+
+// Active sinks and the configuration they were opened with
+var (
+	sinks        = []Sink{newWriterSink("stderr", os.Stderr, nil)}
+	sinksConfig  OutputConfig
+	sinksMutex   sync.RWMutex
+	outputsMutex sync.Mutex
+)
+
+// GetOutputConfig reads the LOG_FILE, LOG_SYSLOG and LOG_JOURNALD options
+func GetOutputConfig() OutputConfig {
+	return OutputConfig{
+		File:     GetFileConfig(),
+		Syslog:   GetSyslogConfig(),
+		Journald: options.Bool("LOG_JOURNALD", false),
+	}
+}
+
+// SetOutputs opens the configured sinks and swaps them in. All new sinks
+// are opened before the old ones are closed, so on error logging continues
+// unchanged.
+func SetOutputs(config OutputConfig) error {
+	outputsMutex.Lock()
+	defer outputsMutex.Unlock()
+
+	if config == sinksConfig {
+		return nil
+	}
+
+	next := []Sink{newWriterSink("stderr", os.Stderr, nil)}
+	fail := func(err error) error {
+		for _, sink := range next[1:] {
+			sink.Close()
+		}
+		return err
+	}
+
+	if config.File.Path != "" {
+		file, err := OpenRotatingFile(config.File)
+		if err != nil {
+			return fail(err)
+		}
+		next = append(next, newWriterSink("file "+config.File.Path, file, file))
+	}
+	if config.Syslog.Address != "" {
+		sink, err := NewSyslogSink(config.Syslog)
+		if err != nil {
+			return fail(err)
+		}
+		next = append(next, sink)
+	}
+	if config.Journald {
+		sink, err := NewJournaldSink(JournaldSocket)
+		if err != nil {
+			return fail(err)
+		}
+		next = append(next, sink)
+	}
+
+	sinksMutex.Lock()
+	previous := sinks
+	sinks = next
+	sinksConfig = config
+	sinksMutex.Unlock()
+
+	for _, sink := range previous {
+		sink.Close()
+	}
+	return nil
+}
+
+// writerSink writes records to an io.Writer in the current format: text
+// lines behind the standard date prefix, or one JSON object per line
+type writerSink struct {
+	name   string
+	logger *log.Logger
+	closer io.Closer
+	mutex  sync.Mutex
+}
+
+// newWriterSink creates a sink writing to w; closer, when not nil, is
+// closed with the sink
+func newWriterSink(name string, w io.Writer, closer io.Closer) *writerSink {
+	return &writerSink{
+		name:   name,
+		logger: log.New(w, "", log.LstdFlags),
+		closer: closer,
+	}
+}
+
+// Name identifies the sink in error messages
+func (ws *writerSink) Name() string {
+	return ws.name
+}
+
+// Write writes one record
+func (ws *writerSink) Write(record types.LogRecord) error {
+	if !jsonFormat.Load() {
+		return ws.logger.Output(2, record.Text())
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode log record: %v", err)
+	}
+
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+
+	_, err = ws.logger.Writer().Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the underlying writer when it is owned by the sink
+func (ws *writerSink) Close() error {
+	if ws.closer == nil {
+		return nil
+	}
+	return ws.closer.Close()
+}
@@ -0,0 +1,244 @@
+package logging
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/options"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// syslogEnterpriseID qualifies the structured-data element carrying record
+// fields; 32473 is the IANA number reserved for documentation and examples
+const syslogEnterpriseID = "32473"
+
+// Syslog reconnect limits. Records arriving while the server is
+// unreachable are dropped and counted like those overflowing the queue.
+const (
+	syslogDialTimeout = 5 * time.Second
+	syslogMaxBackoff  = time.Minute
+)
+
+// syslogFacilities maps facility names to their RFC 5424 codes
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// SyslogConfig describes a syslog destination
+type SyslogConfig struct {
+	// Address is udp://host:port, tcp://host:port or unix:///path
+	Address  string
+	Facility int
+}
+
+// SyslogSink sends records to a syslog server as RFC 5424 messages. UDP and
+// unix sockets carry one message per datagram; TCP uses RFC 6587 octet
+// counting. Records are sent from a sinkQueue; after a failed write the
+// connection is reopened with exponential backoff.
+type SyslogSink struct {
+	network  string
+	address  string
+	facility int
+	hostname string
+	appName  string
+	queue    *sinkQueue
+
+	// Used only by the sending goroutine
+	conn    net.Conn
+	backoff time.Duration
+	retryAt time.Time
+}
+
+// GetSyslogConfig reads the LOG_SYSLOG options
+func GetSyslogConfig() SyslogConfig {
+	facilityName := strings.ToLower(options.Get("LOG_SYSLOG_FACILITY"))
+	if facilityName == "" {
+		facilityName = options.Default("LOG_SYSLOG_FACILITY")
+	}
+	facility, ok := syslogFacilities[facilityName]
+	if !ok {
+		Logf(types.LogWarn, "Invalid LOG_SYSLOG_FACILITY value: %s, using default %s", facilityName, options.Default("LOG_SYSLOG_FACILITY"))
+		facility = syslogFacilities[options.Default("LOG_SYSLOG_FACILITY")]
+	}
+
+	return SyslogConfig{
+		Address:  options.Get("LOG_SYSLOG"),
+		Facility: facility,
+	}
+}
+
+// NewSyslogSink connects to the syslog destination
+func NewSyslogSink(config SyslogConfig) (*SyslogSink, error) {
+	parsed, err := url.Parse(config.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOG_SYSLOG address '%s': %v", config.Address, err)
+	}
+
+	sink := &SyslogSink{
+		facility: config.Facility,
+		appName:  filepath.Base(os.Args[0]),
+	}
+	switch parsed.Scheme {
+	case "udp", "tcp":
+		sink.network, sink.address = parsed.Scheme, parsed.Host
+	case "unix":
+		sink.network, sink.address = "unixgram", parsed.Path
+	default:
+		return nil, fmt.Errorf("invalid LOG_SYSLOG address '%s': scheme must be udp, tcp or unix", config.Address)
+	}
+
+	sink.hostname, err = os.Hostname()
+	if err != nil || sink.hostname == "" {
+		sink.hostname = "-"
+	}
+
+	if err := sink.connect(); err != nil {
+		return nil, err
+	}
+	sink.queue = newSinkQueue(sink.send, sink.disconnect)
+	return sink, nil
+}
+
+// connect (re)opens the connection to the syslog destination
+func (ss *SyslogSink) connect() error {
+	conn, err := net.DialTimeout(ss.network, ss.address, syslogDialTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog at %s: %v", ss.address, err)
+	}
+	ss.conn = conn
+	return nil
+}
+
+// Name identifies the sink in error messages
+func (ss *SyslogSink) Name() string {
+	return "syslog " + ss.network + "://" + ss.address
+}
+
+// Write queues one record for the sending goroutine; it never blocks
+func (ss *SyslogSink) Write(record types.LogRecord) error {
+	message := ss.format(record)
+	if ss.network == "tcp" {
+		message = fmt.Sprintf("%d %s", len(message), message)
+	}
+	ss.queue.push([]byte(message))
+	return nil
+}
+
+// disconnect closes the connection once the queue has been sent
+func (ss *SyslogSink) disconnect() {
+	if ss.conn != nil {
+		ss.conn.Close()
+	}
+}
+
+// send writes one message, reconnecting first when the connection was lost
+// and the backoff has passed; otherwise the message is dropped. Each failed
+// connect or write doubles the backoff and a successful write resets it. Failures
+// go to stderr because logging them would loop back into this sink.
+func (ss *SyslogSink) send(message []byte) {
+	if ss.conn == nil {
+		if time.Now().Before(ss.retryAt) {
+			ss.queue.dropped.Add(1)
+			return
+		}
+		if err := ss.connect(); err != nil {
+			ss.queue.dropped.Add(1)
+			ss.retryLater()
+			fmt.Fprintf(os.Stderr, "log output %s failed, retrying in %v: %v\n", ss.Name(), ss.backoff, err)
+			return
+		}
+	}
+
+	if dropped := ss.queue.dropped.Swap(0); dropped > 0 {
+		fmt.Fprintf(os.Stderr, "log output %s dropped %d record(s)\n", ss.Name(), dropped)
+	}
+
+	ss.conn.SetWriteDeadline(time.Now().Add(sinkWriteTimeout))
+	if _, err := ss.conn.Write(message); err != nil {
+		ss.conn.Close()
+		ss.conn = nil
+		ss.queue.dropped.Add(1)
+		ss.retryLater()
+		fmt.Fprintf(os.Stderr, "log output %s failed, retrying in %v: %v\n", ss.Name(), ss.backoff, err)
+		return
+	}
+	ss.backoff = 0
+}
+
+// retryLater doubles the reconnect backoff, up to syslogMaxBackoff
+func (ss *SyslogSink) retryLater() {
+	ss.backoff *= 2
+	if ss.backoff == 0 {
+		ss.backoff = time.Second
+	}
+	if ss.backoff > syslogMaxBackoff {
+		ss.backoff = syslogMaxBackoff
+	}
+	ss.retryAt = time.Now().Add(ss.backoff)
+}
+
+// Close stops the sink after the queued records were sent
+func (ss *SyslogSink) Close() error {
+	ss.queue.close()
+	return nil
+}
+
+// format renders a record as an RFC 5424 message, carrying its fields as
+// structured data:
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [fields@32473 k="v"] MSG
+func (ss *SyslogSink) format(record types.LogRecord) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d - ",
+		ss.facility*8+syslogSeverity(record.Level),
+		record.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		ss.hostname, ss.appName, os.Getpid())
+
+	if len(record.Fields) == 0 {
+		b.WriteString("-")
+	} else {
+		keys := make([]string, 0, len(record.Fields))
+		for key := range record.Fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		b.WriteString("[fields@" + syslogEnterpriseID)
+		for _, key := range keys {
+			fmt.Fprintf(&b, " %s=\"%s\"", key, escapeSDValue(record.Fields[key]))
+		}
+		b.WriteString("]")
+	}
+
+	b.WriteString(" ")
+	b.WriteString(record.Message)
+	return b.String()
+}
+
+// syslogSeverity maps a log level to its syslog severity
+func syslogSeverity(level types.Log) int {
+	switch level {
+	case types.LogDebug:
+		return 7
+	case types.LogInfo:
+		return 6
+	case types.LogWarn:
+		return 4
+	default:
+		return 3
+	}
+}
+
+// escapeSDValue escapes the characters RFC 5424 reserves in structured
+// data parameter values
+func escapeSDValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
@@ -0,0 +1,50 @@
+package metrics
+
+// Discovery request metrics
+var (
+	// RequestsReceived counts every UDP packet read by the listener
+	RequestsReceived = NewCounterVec("jdp_discovery_requests_received_total", "Discovery packets received by the listener.")
+	// RequestsAnswered counts requests that received at least one response
+	RequestsAnswered = NewCounterVec("jdp_discovery_requests_answered_total", "Discovery requests that received at least one response.")
+	// RequestsBlocked counts requests rejected by access rules
+	RequestsBlocked = NewCounterVec("jdp_discovery_requests_blocked_total", "Discovery requests rejected by access rules, by reason.", "reason")
+	// RequestsIgnored counts requests that were not answered for other reasons
+	RequestsIgnored = NewCounterVec("jdp_discovery_requests_ignored_total", "Discovery packets that were not answered, by reason.", "reason")
+	// ResponsesSent counts discovery responses written to clients
+	ResponsesSent = NewCounterVec("jdp_discovery_responses_sent_total", "Discovery responses sent, by type (primary, ipv6, hostname_resolved).", "type")
+)
+
+// Upstream and cache metrics
+var (
+	// UpstreamFetches counts /System/Info/Public requests to Jellyfin
+	UpstreamFetches = NewCounterVec("jdp_upstream_fetches_total", "Requests made to the Jellyfin /System/Info/Public endpoint.")
+	// UpstreamFailures counts failed /System/Info/Public requests
+	UpstreamFailures = NewCounterVec("jdp_upstream_fetch_failures_total", "Failed requests to the Jellyfin /System/Info/Public endpoint.")
+	// UpstreamLatency observes /System/Info/Public request durations
+	UpstreamLatency = NewHistogram("jdp_upstream_fetch_duration_seconds", "Duration of requests to the Jellyfin /System/Info/Public endpoint.",
+		[]float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10})
+	// CacheHits counts requests answered from cached server info
+	CacheHits = NewCounterVec("jdp_cache_hits_total", "Discovery requests answered from cached server info.")
+	// CacheMisses counts requests that needed a fresh upstream fetch
+	CacheMisses = NewCounterVec("jdp_cache_misses_total", "Discovery requests that needed a fresh upstream fetch.")
+)
+
+// Hook metrics
+var (
+	// HookExecutions counts hook runs by event
+	HookExecutions = NewCounterVec("jdp_hook_executions_total", "Hook executions, by event.", "event")
+	// HookFailures counts failed hook runs by event
+	HookFailures = NewCounterVec("jdp_hook_failures_total", "Failed hook executions, by event.", "event")
+	// HookRetries counts webhook retries by event
+	HookRetries = NewCounterVec("jdp_hook_retries_total", "Webhook attempts retried after a retryable failure, by event.", "event")
+	// HookDeadLettered counts hook runs written to the dead-letter file
+	HookDeadLettered = NewCounterVec("jdp_hook_dead_lettered_total", "Hook runs written to the dead-letter file, by event and hook type.", "event", "type")
+	// HookDropped counts hook runs dropped because their queue was full or
+	// shutdown did not wait for them
+	HookDropped = NewCounterVec("jdp_hook_dropped_total", "Hook runs dropped without executing, by event and hook type.", "event", "type")
+	// HookQueueDepth reports hook runs waiting for a worker
+	HookQueueDepth = NewGaugeVec("jdp_hook_queue_depth", "Hook runs waiting to execute, by event and hook type.", "event", "type")
+)
+
+// BuildInfo is always 1 and carries the build version as labels
+var BuildInfo = NewGaugeVec("jdp_build_info", "Build information for the running proxy.", "version", "goversion")
@@ -0,0 +1,237 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metric is anything that can write itself in the Prometheus text format
+type metric interface {
+	write(w io.Writer)
+}
+
+// registry holds every metric in registration order
+var (
+	registry   []metric
+	registryMu sync.Mutex
+)
+
+// register adds a metric to the exposition output
+func register(m metric) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	registry = append(registry, m)
+}
+
+// WriteText writes every registered metric in the Prometheus text
+// exposition format (version 0.0.4)
+func WriteText(w io.Writer) {
+	registryMu.Lock()
+	metrics := make([]metric, len(registry))
+	copy(metrics, registry)
+	registryMu.Unlock()
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// vector holds values keyed by their label values
+type vector struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	values map[string]float64
+	mutex  sync.Mutex
+}
+
+func newVector(name, help, kind string, labels []string) *vector {
+	return &vector{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		values: make(map[string]float64),
+	}
+}
+
+// key joins label values into a map key, panicking on a label count
+// mismatch since that is always a programming error
+func (v *vector) key(labelValues []string) string {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func (v *vector) write(w io.Writer) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	writeHeader(w, v.name, v.help, v.kind)
+	if len(v.labels) == 0 {
+		fmt.Fprintf(w, "%s %s\n", v.name, formatValue(v.values[""]))
+		return
+	}
+
+	keys := make([]string, 0, len(v.values))
+	for key := range v.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, formatLabels(v.labels, strings.Split(key, "\xff")), formatValue(v.values[key]))
+	}
+}
+
+// CounterVec is a monotonically increasing value, optionally split by labels
+type CounterVec struct {
+	vec *vector
+}
+
+// NewCounterVec registers a counter with the given label names
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec: newVector(name, help, "counter", labels)}
+	register(c.vec)
+	return c
+}
+
+// Inc increments the counter for the given label values by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter for the given label values by delta
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	key := c.vec.key(labelValues)
+	c.vec.mutex.Lock()
+	defer c.vec.mutex.Unlock()
+
+	c.vec.values[key] += delta
+}
+
+// GaugeVec is a value that can go up and down, optionally split by labels
+type GaugeVec struct {
+	vec *vector
+}
+
+// NewGaugeVec registers a gauge with the given label names
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{vec: newVector(name, help, "gauge", labels)}
+	register(g.vec)
+	return g
+}
+
+// Set sets the gauge for the given label values
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	key := g.vec.key(labelValues)
+	g.vec.mutex.Lock()
+	defer g.vec.mutex.Unlock()
+
+	g.vec.values[key] = value
+}
+
+// GaugeFunc is a gauge whose value is computed at scrape time. The function
+// returns false when there is no value to report.
+type GaugeFunc struct {
+	name string
+	help string
+	fn   func() (float64, bool)
+}
+
+// NewGaugeFunc registers a gauge computed by fn on every scrape
+func NewGaugeFunc(name, help string, fn func() (float64, bool)) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, fn: fn}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	if value, ok := g.fn(); ok {
+		fmt.Fprintf(w, "%s %s\n", g.name, formatValue(value))
+	}
+}
+
+// Histogram counts observations into cumulative buckets
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+	mutex   sync.Mutex
+}
+
+// NewHistogram registers a histogram with the given upper bucket bounds
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{
+		name:    name,
+		help:    help,
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+	register(h)
+	return h
+}
+
+// Observe records a single value
+func (h *Histogram) Observe(value float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	for i, bound := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatValue(bound), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.name, formatValue(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+func formatLabels(names, values []string) string {
+	escaper := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=\"%s\"", name, escaper.Replace(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,69 @@
+package neighbors
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// ARPTablePath is the Linux IPv4 neighbor table
+var ARPTablePath = "/proc/net/arp"
+
+// Lookup returns the MAC address the kernel neighbor table holds for ip, or
+// an empty string when the address is unknown, incomplete, or the table is
+// unavailable (non-Linux systems, clients behind a router).
+func Lookup(ip string) string {
+	f, err := os.Open(ARPTablePath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	// IP address  HW type  Flags  HW address  Mask  Device
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // skip header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[0] != ip {
+			continue
+		}
+		// Flags 0x0 marks an incomplete entry that never resolved
+		if fields[2] == "0x0" || fields[3] == "00:00:00:00:00:00" {
+			return ""
+		}
+		return strings.ToLower(fields[3])
+	}
+	return ""
+}
+
+// resolvePollInterval is how often Resolve re-reads the neighbor table
+const resolvePollInterval = 50 * time.Millisecond
+
+// Resolve is Lookup for clients that may be missing from the table. A
+// client that only broadcasts gets no entry until the host sends to it, so
+// when ip is unknown an empty datagram is sent to its discard port (9) to
+// make the kernel resolve it, and the table is read again until wait
+// elapses. The client never sees the datagram on its discovery socket.
+func Resolve(ip string, wait time.Duration) string {
+	if mac := Lookup(ip); mac != "" {
+		return mac
+	}
+
+	conn, err := net.Dial("udp4", net.JoinHostPort(ip, "9"))
+	if err != nil {
+		return ""
+	}
+	conn.Write(nil)
+	conn.Close()
+
+	deadline := time.Now().Add(wait)
+	for time.Now().Before(deadline) {
+		time.Sleep(resolvePollInterval)
+		if mac := Lookup(ip); mac != "" {
+			return mac
+		}
+	}
+	return ""
+}
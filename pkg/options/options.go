@@ -0,0 +1,269 @@
+package options
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Option describes a single configuration setting. Every option can be set
+// through its environment variable, the equivalent command-line flag or the
+// configuration file; flags take precedence over the environment, which
+// takes precedence over the file.
+type Option struct {
+	Env     string
+	Flag    string
+	Arg     string
+	Default string
+	Usage   string
+	// Secret options are never shown in logs or configuration diffs
+	Secret bool
+}
+
+// All lists every configuration option the proxy understands, in the order
+// they are shown in --help output.
+var All = []Option{
+	{Env: "CONFIG_FILE", Flag: "config", Arg: "PATH", Usage: "File of KEY=VALUE lines re-read on SIGHUP; environment and flags take precedence"},
+	{Env: "JELLYFIN_SERVER_URL", Flag: "server-url", Arg: "URL", Default: "http://localhost:8096", Usage: "URL the proxy fetches /System/Info/Public from"},
+	{Env: "PROXY_URL", Flag: "proxy-url", Arg: "URL", Usage: "URL advertised to discovery clients (defaults to the server URL)"},
+	{Env: "PROXY_URL_IPV6", Flag: "proxy-url-ipv6", Arg: "URL", Usage: "Optional second URL advertised for dual-stack clients"},
+	{Env: "NETWORK_INTERFACE", Flag: "interface", Arg: "NAME", Usage: "Bind discovery to a specific interface (defaults to all interfaces)"},
+	{Env: "HTTP_ENABLED", Flag: "http-enabled", Arg: "BOOL", Default: "true", Usage: "Serve the dashboard, API and metrics; false runs discovery only"},
+	{Env: "HTTP_BIND", Flag: "http-bind", Arg: "ADDR", Usage: "Dashboard bind address: an IP (defaults to all interfaces) or unix:/path/to/socket"},
+	{Env: "HTTP_PORT", Flag: "http-port", Arg: "PORT", Default: "8080", Usage: "Dashboard and health check port"},
+	{Env: "HTTP_BASE_PATH", Flag: "http-base-path", Arg: "PATH", Usage: "Serve every route and asset under this path prefix, e.g. /jdp behind a reverse proxy"},
+	{Env: "TRUSTED_PROXIES", Flag: "trusted-proxies", Arg: "LIST", Usage: "Comma-separated proxy IPs/subnets whose X-Forwarded-For/-Host/-Proto headers are honored"},
+	{Env: "TLS_CERT_FILE", Flag: "tls-cert-file", Arg: "PATH", Usage: "Serve HTTPS with this PEM certificate chain, reloaded when the file changes"},
+	{Env: "TLS_KEY_FILE", Flag: "tls-key-file", Arg: "PATH", Usage: "PEM private key for TLS_CERT_FILE"},
+	{Env: "AUTH_USERS", Flag: "auth-users", Arg: "LIST", Secret: true, Usage: "Comma-separated user:bcrypt-hash pairs allowed into the dashboard and API (see hash-password)"},
+	{Env: "AUTH_API_TOKENS", Flag: "auth-api-tokens", Arg: "LIST", Secret: true, Usage: "Comma-separated bearer tokens accepted by the JSON API and metrics"},
+	{Env: "CACHE_DURATION", Flag: "cache-duration", Arg: "HOURS", Default: "24", Usage: "Hours to cache server info (0 = until restart)"},
+	{Env: "LOG_LEVEL", Flag: "log-level", Arg: "LEVEL", Default: "info", Usage: "Log level (debug, info, warn, error)"},
+	{Env: "LOG_LEVELS", Flag: "log-levels", Arg: "LIST", Usage: "Per-component log levels, e.g. discovery=debug,hooks=warn (components: discovery, upstream, hooks, web, auth, config)"},
+	{Env: "LOG_FORMAT", Flag: "log-format", Arg: "FORMAT", Default: "text", Usage: "Log output format: text or json"},
+	{Env: "LOG_DEDUP_WINDOW", Flag: "log-dedup-window", Arg: "SECONDS", Default: "60", Usage: "Window for suppressing repeated log messages (0 = never suppress)"},
+	{Env: "LOG_DEDUP_BURST", Flag: "log-dedup-burst", Arg: "COUNT", Default: "5", Usage: "Identical messages per client logged in each window before the rest are summarized"},
+	{Env: "LOG_FILE", Flag: "log-file", Arg: "PATH", Usage: "Also write logs to this file, rotating it by size and age"},
+	{Env: "LOG_FILE_MAX_SIZE", Flag: "log-file-max-size", Arg: "MB", Default: "10", Usage: "Rotate the log file once it reaches this many megabytes (0 = no size limit)"},
+	{Env: "LOG_FILE_MAX_AGE", Flag: "log-file-max-age", Arg: "HOURS", Default: "0", Usage: "Rotate the log file after this many hours (0 = no age limit)"},
+	{Env: "LOG_FILE_BACKUPS", Flag: "log-file-backups", Arg: "COUNT", Default: "5", Usage: "Rotated log files to keep"},
+	{Env: "LOG_FILE_COMPRESS", Flag: "log-file-compress", Arg: "BOOL", Default: "true", Usage: "Gzip rotated log files"},
+	{Env: "LOG_SYSLOG", Flag: "log-syslog", Arg: "ADDR", Usage: "Also send logs to syslog (RFC 5424) at udp://host:port, tcp://host:port or unix:///dev/log"},
+	{Env: "LOG_SYSLOG_FACILITY", Flag: "log-syslog-facility", Arg: "NAME", Default: "daemon", Usage: "Syslog facility (daemon, user, local0-local7, ...)"},
+	{Env: "LOG_JOURNALD", Flag: "log-journald", Arg: "BOOL", Default: "false", Usage: "Also send logs to the systemd journal with structured fields"},
+	{Env: "LOG_BUFFER_SIZE", Flag: "log-buffer-size", Arg: "LINES", Default: "100", Usage: "Log lines kept in memory for the dashboard"},
+	{Env: "CLIENT_EXPIRY", Flag: "client-expiry", Arg: "HOURS", Default: "24", Usage: "Hours an idle client stays in the client inventory (0 = until restart)"},
+	{Env: "CLIENT_NAMES_FILE", Flag: "client-names-file", Arg: "PATH", Usage: "JSON file mapping client MAC addresses or IPs to friendly names, updated when names are edited"},
+	{Env: "CLIENT_REVERSE_DNS", Flag: "client-reverse-dns", Arg: "BOOL", Default: "false", Usage: "Look up client hostnames with reverse DNS"},
+	{Env: "BLACKLIST", Flag: "blacklist", Arg: "LIST", Usage: "Comma-separated IPs/subnets to block"},
+	{Env: "MAC_ALLOWLIST", Flag: "mac-allowlist", Arg: "LIST", Usage: "Comma-separated MAC addresses; when set, only these devices are answered"},
+	{Env: "MAC_DENYLIST", Flag: "mac-denylist", Arg: "LIST", Usage: "Comma-separated MAC addresses that are never answered"},
+	{Env: "MAC_UNRESOLVED", Flag: "mac-unresolved", Arg: "MODE", Default: "allow", Usage: "With MAC rules set, answer (allow) or ignore (deny) clients whose MAC cannot be resolved"},
+	{Env: "HOOK_ON_RECEIVE_URL", Flag: "hook-on-receive-url", Arg: "URL", Usage: "Webhook called when a discovery request is received"},
+	{Env: "HOOK_ON_RECEIVE_HEADERS", Flag: "hook-on-receive-headers", Arg: "LIST", Secret: true, Usage: "Comma-separated 'Name: value' headers sent with the onReceive webhook; a value of @PATH is read from that file"},
+	{Env: "HOOK_ON_RECEIVE_BEARER_TOKEN", Flag: "hook-on-receive-bearer-token", Arg: "TOKEN", Secret: true, Usage: "Bearer token sent with the onReceive webhook, or @PATH to read it from a file"},
+	{Env: "HOOK_ON_RECEIVE_SECRET", Flag: "hook-on-receive-secret", Arg: "SECRET", Secret: true, Usage: "Sign onReceive webhooks with HMAC-SHA256 using this secret, or @PATH to read it from a file"},
+	{Env: "HOOK_ON_RECEIVE_CMD", Flag: "hook-on-receive-cmd", Arg: "CMD", Usage: "Shell command executed when a discovery request is received"},
+	{Env: "HOOK_ON_SEND_URL", Flag: "hook-on-send-url", Arg: "URL", Usage: "Webhook called before a discovery response is sent"},
+	{Env: "HOOK_ON_SEND_HEADERS", Flag: "hook-on-send-headers", Arg: "LIST", Secret: true, Usage: "Comma-separated 'Name: value' headers sent with the onSend webhook; a value of @PATH is read from that file"},
+	{Env: "HOOK_ON_SEND_BEARER_TOKEN", Flag: "hook-on-send-bearer-token", Arg: "TOKEN", Secret: true, Usage: "Bearer token sent with the onSend webhook, or @PATH to read it from a file"},
+	{Env: "HOOK_ON_SEND_SECRET", Flag: "hook-on-send-secret", Arg: "SECRET", Secret: true, Usage: "Sign onSend webhooks with HMAC-SHA256 using this secret, or @PATH to read it from a file"},
+	{Env: "HOOK_ON_SEND_CMD", Flag: "hook-on-send-cmd", Arg: "CMD", Usage: "Shell command executed before a discovery response is sent"},
+	{Env: "HOOK_QUEUE_SIZE", Flag: "hook-queue-size", Arg: "COUNT", Default: "100", Usage: "Hook runs each hook may have waiting; further events are dropped and counted"},
+	{Env: "HOOK_CONCURRENCY", Flag: "hook-concurrency", Arg: "COUNT", Default: "2", Usage: "Runs of each hook executed at the same time"},
+	{Env: "HOOK_RETRIES", Flag: "hook-retries", Arg: "COUNT", Default: "3", Usage: "Retries for webhooks failing with a timeout, connection error or 5xx status"},
+	{Env: "HOOK_RETRY_BACKOFF", Flag: "hook-retry-backoff", Arg: "MS", Default: "1000", Usage: "Delay before the first webhook retry, doubled (with jitter) for each further retry"},
+	{Env: "HOOK_DEAD_LETTER_FILE", Flag: "hook-dead-letter-file", Arg: "PATH", Usage: "File that keeps hook events that failed permanently or ran out of retries, for replay"},
+	{Env: "HOOK_DRAIN_TIMEOUT", Flag: "hook-drain-timeout", Arg: "SECONDS", Default: "30", Usage: "How long shutdown waits for queued hook runs (0 = until all finish)"},
+}
+
+// overrides holds values set from command-line flags and fileValues holds
+// values read from CONFIG_FILE, both keyed by env name
+var (
+	overrides   = make(map[string]string)
+	fileValues  = make(map[string]string)
+	overridesMu sync.RWMutex
+)
+
+// Get returns the configured value for the option with the given env name.
+// A value set by flag wins over the environment, which wins over the
+// configuration file. Empty environment variables count as unset, matching
+// how the loaders treat them. An empty result means the option was not set
+// at all and the caller should apply its default.
+func Get(env string) string {
+	overridesMu.RLock()
+	defer overridesMu.RUnlock()
+
+	if value, ok := overrides[env]; ok {
+		return value
+	}
+	if value := os.Getenv(env); value != "" {
+		return value
+	}
+	return fileValues[env]
+}
+
+// Values returns the current value of every option, keyed by env name
+func Values() map[string]string {
+	values := make(map[string]string, len(All))
+	for _, opt := range All {
+		values[opt.Env] = Get(opt.Env)
+	}
+	return values
+}
+
+// LoadFile replaces the file layer with the KEY=VALUE pairs read from path.
+// Blank lines and lines starting with # are ignored, values may be quoted.
+// Unknown keys are returned as warnings rather than errors so a file shared
+// with other tools still loads.
+func LoadFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	var warnings []string
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNum)
+		}
+		key = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(key), "export "))
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+
+		if !known(key) {
+			warnings = append(warnings, fmt.Sprintf("%s:%d: unknown option %s", path, lineNum, key))
+			continue
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	overridesMu.Lock()
+	fileValues = values
+	overridesMu.Unlock()
+	return warnings, nil
+}
+
+// known reports whether env names a registered option
+func known(env string) bool {
+	for _, opt := range All {
+		if opt.Env == env {
+			return true
+		}
+	}
+	return false
+}
+
+// Set overrides the value of an option, as if it had been passed by flag
+func Set(env, value string) {
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+
+	overrides[env] = value
+}
+
+// Warnf reports invalid option values. It discards them until the logging
+// package, which cannot be imported here, points it at the log.
+var Warnf = func(format string, v ...interface{}) {}
+
+// Int parses a non-negative integer option, returning def when it is unset
+// or invalid
+func Int(env string, def int) int {
+	value := Get(env)
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		Warnf("Invalid %s value: %s, using default %d", env, value, def)
+		return def
+	}
+	return parsed
+}
+
+// Bool parses a boolean option with strconv.ParseBool, returning def when
+// it is unset or invalid
+func Bool(env string, def bool) bool {
+	value := Get(env)
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		Warnf("Invalid %s value: %s, using default %t", env, value, def)
+		return def
+	}
+	return parsed
+}
+
+// Default returns the default value for the option with the given env name
+func Default(env string) string {
+	for _, opt := range All {
+		if opt.Env == env {
+			return opt.Default
+		}
+	}
+	return ""
+}
+
+// flagValue routes a parsed flag into the override table
+type flagValue struct {
+	env     string
+	boolean bool
+}
+
+func (f flagValue) String() string {
+	return ""
+}
+
+func (f flagValue) Set(value string) error {
+	Set(f.env, value)
+	return nil
+}
+
+// IsBoolFlag lets boolean options be passed bare, e.g. -http-enabled
+func (f flagValue) IsBoolFlag() bool {
+	return f.boolean
+}
+
+// RegisterFlags adds a flag for every option to the given flag set
+func RegisterFlags(fs *flag.FlagSet) {
+	for _, opt := range All {
+		fs.Var(flagValue{env: opt.Env, boolean: opt.Arg == "BOOL"}, opt.Flag, opt.Usage)
+	}
+}
+
+// WriteUsage prints the flag reference for every option, including the
+// matching environment variable and default value.
+func WriteUsage(w io.Writer) {
+	for _, opt := range All {
+		fmt.Fprintf(w, "  -%s %s\n", opt.Flag, opt.Arg)
+		fmt.Fprintf(w, "        %s\n", opt.Usage)
+		if opt.Default != "" {
+			fmt.Fprintf(w, "        env: %s, default: %s\n", opt.Env, opt.Default)
+		} else {
+			fmt.Fprintf(w, "        env: %s\n", opt.Env)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package options
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadFilePrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jdp.env")
+	content := `# comment
+JELLYFIN_SERVER_URL=http://file:8096
+export PROXY_URL="http://file-proxy:8096"
+HTTP_PORT='9000'
+LOG_LEVEL=debug
+NOT_AN_OPTION=1
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	warnings, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("LoadFile() warnings = %q, want one unknown option", warnings)
+	}
+	t.Cleanup(func() {
+		overridesMu.Lock()
+		overrides = make(map[string]string)
+		fileValues = make(map[string]string)
+		overridesMu.Unlock()
+	})
+
+	t.Setenv("JELLYFIN_SERVER_URL", "")
+	t.Setenv("CACHE_DURATION", "")
+	t.Setenv("PROXY_URL", "http://env-proxy:8096")
+	t.Setenv("HTTP_PORT", "9100")
+	t.Setenv("LOG_LEVEL", "")
+	Set("HTTP_PORT", "9200")
+
+	tests := []struct {
+		env  string
+		want string
+	}{
+		{"JELLYFIN_SERVER_URL", "http://file:8096"},
+		{"PROXY_URL", "http://env-proxy:8096"},
+		{"HTTP_PORT", "9200"},
+		{"LOG_LEVEL", "debug"},
+		{"CACHE_DURATION", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			if got := Get(tt.env); got != tt.want {
+				t.Errorf("Get(%s) = %q, want %q", tt.env, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		missing bool
+	}{
+		{name: "missing separator", content: "JELLYFIN_SERVER_URL http://file:8096\n"},
+		{name: "missing file", missing: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "jdp.env")
+			if !tt.missing {
+				if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := LoadFile(path); err == nil {
+				t.Error("LoadFile() error = nil, want an error")
+			}
+		})
+	}
+}
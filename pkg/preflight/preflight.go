@@ -0,0 +1,119 @@
+package preflight
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/server"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// Result is the outcome of a single preflight check
+type Result struct {
+	Name   string
+	OK     bool
+	Detail string
+}
+
+// Report collects the results of a preflight run
+type Report struct {
+	Results []Result
+}
+
+// Pass records a successful check
+func (r *Report) Pass(name, format string, v ...interface{}) {
+	r.Results = append(r.Results, Result{Name: name, OK: true, Detail: fmt.Sprintf(format, v...)})
+}
+
+// Fail records a failed check
+func (r *Report) Fail(name, format string, v ...interface{}) {
+	r.Results = append(r.Results, Result{Name: name, OK: false, Detail: fmt.Sprintf(format, v...)})
+}
+
+// Failed returns the number of failed checks
+func (r *Report) Failed() int {
+	failed := 0
+	for _, result := range r.Results {
+		if !result.OK {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Run checks that the upstream Jellyfin server is reachable, that every
+// advertised URL resolves and serves the same server, and that the discovery
+// port can be bound.
+func Run(cfg *types.Config, report *Report) {
+	upstream, err := server.FetchInfo(cfg.ServerURL)
+	if err != nil {
+		report.Fail("Upstream server info", "%s: %v", cfg.ServerURL, err)
+	} else {
+		report.Pass("Upstream server info", "%s (Id: %s, Name: %s)", cfg.ServerURL, upstream.Id, upstream.ServerName)
+	}
+
+	checkAdvertisedURL(report, "Proxy URL", cfg.ProxyURL, upstream)
+	if cfg.ProxyURLv6 != "" && cfg.ProxyURLv6 != cfg.ProxyURL {
+		checkAdvertisedURL(report, "Proxy URL (IPv6)", cfg.ProxyURLv6, upstream)
+	}
+
+	checkDiscoveryPort(report, cfg.BindIP)
+}
+
+// checkAdvertisedURL resolves a hostname URL to the IP variant that is also
+// advertised to clients and probes every resulting URL.
+func checkAdvertisedURL(report *Report, label, advertisedURL string, upstream *types.SystemInfoResponse) {
+	probeURL(report, label, advertisedURL, upstream)
+
+	if !server.IsHostname(advertisedURL) {
+		return
+	}
+
+	ipURL, err := server.ResolveHostnameToIP(advertisedURL)
+	if err != nil {
+		report.Fail(label+" DNS", "%s: %v", advertisedURL, err)
+		return
+	}
+	report.Pass(label+" DNS", "%s resolves to %s", advertisedURL, ipURL)
+	probeURL(report, label+" (resolved)", ipURL, upstream)
+}
+
+// probeURL fetches server info through an advertised URL and confirms it
+// reports the same server Id as the upstream server.
+func probeURL(report *Report, label, advertisedURL string, upstream *types.SystemInfoResponse) {
+	name := label + " probe"
+	info, err := server.FetchInfo(advertisedURL)
+	if err != nil {
+		report.Fail(name, "%s: %v", advertisedURL, err)
+		return
+	}
+	if upstream == nil {
+		report.Fail(name, "%s serves Id %s, but the upstream Id is unknown", advertisedURL, info.Id)
+		return
+	}
+	if info.Id != upstream.Id {
+		report.Fail(name, "%s serves Id %s, expected %s", advertisedURL, info.Id, upstream.Id)
+		return
+	}
+	report.Pass(name, "%s serves Id %s", advertisedURL, info.Id)
+}
+
+// checkDiscoveryPort verifies the UDP discovery port can be bound
+func checkDiscoveryPort(report *Report, bindIP string) {
+	name := "UDP discovery port"
+	addr := fmt.Sprintf("%s:%d", bindIP, types.DiscoveryPort)
+
+	udpAddr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		report.Fail(name, "%s: %v", addr, err)
+		return
+	}
+
+	conn, err := net.ListenUDP("udp4", udpAddr)
+	if err != nil {
+		report.Fail(name, "%s: %v", addr, err)
+		return
+	}
+	conn.Close()
+	report.Pass(name, "%s can be bound", addr)
+}
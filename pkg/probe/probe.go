@@ -0,0 +1,139 @@
+package probe
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// Broadcast is the target name for the limited broadcast address that
+// Jellyfin clients use
+const Broadcast = "broadcast"
+
+// maxResponseSize bounds a single discovery response datagram
+const maxResponseSize = 4096
+
+// Response is one datagram received in reply to a probe. Parsed is set
+// when the payload is a valid discovery response; otherwise Error says why
+// it could not be parsed.
+type Response struct {
+	From      string                           `json:"from"`
+	LatencyMs float64                          `json:"latency_ms"`
+	Raw       string                           `json:"raw"`
+	Parsed    *types.JellyfinDiscoveryResponse `json:"parsed,omitempty"`
+	Error     string                           `json:"error,omitempty"`
+}
+
+// Result is the outcome of a probe. Errors lists targets the message could
+// not be sent to.
+type Result struct {
+	Message   string     `json:"message"`
+	Targets   []string   `json:"targets"`
+	TimeoutMs float64    `json:"timeout_ms"`
+	Responses []Response `json:"responses"`
+	Errors    []string   `json:"errors,omitempty"`
+}
+
+// ResolveTarget turns a probe target into a UDP address. "broadcast" (or
+// an empty target) is 255.255.255.255; anything else is a host or IP with
+// an optional port, which defaults to the discovery port. A directed
+// broadcast is simply the subnet's broadcast IP, e.g. 192.168.1.255.
+func ResolveTarget(target string) (*net.UDPAddr, error) {
+	if target == "" || target == Broadcast {
+		return &net.UDPAddr{IP: net.IPv4bcast, Port: types.DiscoveryPort}, nil
+	}
+
+	host, port := target, strconv.Itoa(types.DiscoveryPort)
+	if h, p, err := net.SplitHostPort(target); err == nil {
+		host, port = h, p
+	}
+	addr, err := net.ResolveUDPAddr("udp4", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, fmt.Errorf("invalid probe target '%s': %v", target, err)
+	}
+	return addr, nil
+}
+
+// Run sends message to every target from one socket and collects every
+// response that arrives within timeout. When idle is positive, Run returns
+// early once idle passes without a response after the first one. Latency
+// is measured from the moment the message was sent to the target list.
+func Run(targets []string, message string, timeout, idle time.Duration) (*Result, error) {
+	if len(targets) == 0 {
+		targets = []string{Broadcast}
+	}
+
+	addrs := make([]*net.UDPAddr, 0, len(targets))
+	for _, target := range targets {
+		addr, err := ResolveTarget(target)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open probe socket: %v", err)
+	}
+	defer conn.Close()
+
+	result := &Result{
+		Message:   message,
+		TimeoutMs: float64(timeout) / float64(time.Millisecond),
+		Responses: []Response{},
+	}
+	sentAt := time.Now()
+	for _, addr := range addrs {
+		result.Targets = append(result.Targets, addr.String())
+		if _, err := conn.WriteToUDP([]byte(message), addr); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("failed to send to %s: %v", addr, err))
+		}
+	}
+	if len(result.Errors) == len(addrs) {
+		return result, nil
+	}
+
+	deadline := sentAt.Add(timeout)
+	conn.SetReadDeadline(deadline)
+	buffer := make([]byte, maxResponseSize)
+	for {
+		n, from, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return result, fmt.Errorf("failed to read responses: %v", err)
+		}
+		result.Responses = append(result.Responses, parseResponse(from, buffer[:n], time.Since(sentAt)))
+		if idle > 0 {
+			if next := time.Now().Add(idle); next.Before(deadline) {
+				conn.SetReadDeadline(next)
+			}
+		}
+	}
+	return result, nil
+}
+
+// parseResponse decodes one response datagram
+func parseResponse(from *net.UDPAddr, payload []byte, latency time.Duration) Response {
+	response := Response{
+		From:      from.String(),
+		LatencyMs: float64(latency.Microseconds()) / 1000,
+		Raw:       string(payload),
+	}
+
+	var parsed types.JellyfinDiscoveryResponse
+	if err := json.Unmarshal(payload, &parsed); err != nil {
+		response.Error = fmt.Sprintf("not a discovery response: %v", err)
+	} else {
+		response.Parsed = &parsed
+	}
+	return response
+}
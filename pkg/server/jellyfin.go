@@ -6,51 +6,93 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/logging"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/metrics"
 	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
 )
 
+// logger tags this package's log records with the upstream component
+var logger = logging.Component("upstream")
+
+// FetchTimeout bounds a /System/Info/Public request
+const FetchTimeout = 5 * time.Second
+
+// health records the outcome of FetchInfo calls for readiness checks
+var (
+	health      types.UpstreamHealth
+	healthMutex sync.RWMutex
+)
+
 // FetchInfo retrieves server information from Jellyfin System/Info Endpoint
 func FetchInfo(serverURL string) (*types.SystemInfoResponse, error) {
+	start := time.Now()
+	metrics.UpstreamFetches.Inc()
+	serverInfo, err := fetchInfo(serverURL)
+	metrics.UpstreamLatency.Observe(time.Since(start).Seconds())
+
+	healthMutex.Lock()
+	if err != nil {
+		metrics.UpstreamFailures.Inc()
+		health.LastFailure = time.Now()
+		health.LastError = err.Error()
+	} else {
+		health.LastSuccess = time.Now()
+	}
+	healthMutex.Unlock()
+
+	return serverInfo, err
+}
+
+// Health returns the outcome of the most recent fetches
+func Health() types.UpstreamHealth {
+	healthMutex.RLock()
+	defer healthMutex.RUnlock()
+
+	return health
+}
+
+// fetchInfo performs the /System/Info/Public request
+func fetchInfo(serverURL string) (*types.SystemInfoResponse, error) {
 	// Create HTTP client with timeout
 	client := &http.Client{
-		Timeout: 5 * time.Second,
+		Timeout: FetchTimeout,
 	}
-	logging.Logf(types.LogDebug, "Created HTTP client with timeout: 5s")
+	logger.Logf(types.LogDebug, "Created HTTP client with timeout: %v", FetchTimeout)
 
 	// Call the Jellyfin system info endpoint
 	infoURL := fmt.Sprintf("%s/System/Info/Public", serverURL)
-	logging.Logf(types.LogInfo, "Fetching server info from: %s", infoURL)
-	logging.Logf(types.LogDebug, "Making HTTP GET request to: %s", infoURL)
+	logger.Logf(types.LogInfo, "Fetching server info from: %s", infoURL)
+	logger.Logf(types.LogDebug, "Making HTTP GET request to: %s", infoURL)
 
 	resp, err := client.Get(infoURL)
 	if err != nil {
-		logging.Logf(types.LogDebug, "HTTP request error type: %T", err)
+		logger.Logf(types.LogDebug, "HTTP request error type: %T", err)
 		return nil, fmt.Errorf("HTTP request failed: %v", err)
 	}
 	defer resp.Body.Close()
 
-	logging.Logf(types.LogDebug, "HTTP response status: %d %s", resp.StatusCode, resp.Status)
-	logging.Logf(types.LogDebug, "HTTP response headers: %v", resp.Header)
+	logger.Logf(types.LogDebug, "HTTP response status: %d %s", resp.StatusCode, resp.Status)
+	logger.Logf(types.LogDebug, "HTTP response headers: %v", resp.Header)
 
 	if resp.StatusCode != http.StatusOK {
-		logging.Logf(types.LogDebug, "Non-OK status code received: %d", resp.StatusCode)
+		logger.Logf(types.LogDebug, "Non-OK status code received: %d", resp.StatusCode)
 		return nil, fmt.Errorf("HTTP request returned status %d", resp.StatusCode)
 	}
 
 	// Parse response
 	var serverInfo types.SystemInfoResponse
-	logging.Logf(types.LogDebug, "Attempting to decode JSON response body")
+	logger.Logf(types.LogDebug, "Attempting to decode JSON response body")
 	err = json.NewDecoder(resp.Body).Decode(&serverInfo)
 	if err != nil {
-		logging.Logf(types.LogDebug, "JSON decode error type: %T", err)
+		logger.Logf(types.LogDebug, "JSON decode error type: %T", err)
 		return nil, fmt.Errorf("failed to parse JSON response: %v", err)
 	}
 
-	logging.Logf(types.LogInfo, "Successfully retrieved server info from API (Server: %s, ID: %s)", serverInfo.ServerName, serverInfo.Id)
-	logging.Logf(types.LogDebug, "Decoded server info - ServerName: '%s', Id: '%s'", serverInfo.ServerName, serverInfo.Id)
+	logger.Logf(types.LogInfo, "Successfully retrieved server info from API (Server: %s, ID: %s)", serverInfo.ServerName, serverInfo.Id)
+	logger.Logf(types.LogDebug, "Decoded server info - ServerName: '%s', Id: '%s'", serverInfo.ServerName, serverInfo.Id)
 	return &serverInfo, nil
 }
 
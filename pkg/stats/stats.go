@@ -1,10 +1,22 @@
 package stats
 
 import (
+	"time"
+
 	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
 )
 
+// Request rates are kept per minute for the last hour and per hour for the
+// last two days
+const (
+	MinuteBuckets = 60
+	HourBuckets   = 48
+)
+
 // New creates a new RequestStats instance
 func New() *types.RequestStats {
-	return &types.RequestStats{}
+	return &types.RequestStats{
+		PerMinute: &types.RateSeries{Interval: time.Minute, Buckets: make([]types.RateBucket, MinuteBuckets)},
+		PerHour:   &types.RateSeries{Interval: time.Hour, Buckets: make([]types.RateBucket, HourBuckets)},
+	}
 }
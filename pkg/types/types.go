@@ -1,7 +1,11 @@
 package types
 
 import (
+	"fmt"
 	"net"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -13,6 +17,9 @@ var Version = "DEBUG"
 // "Who is JellyfinServer?" client-discovery broadcast.
 const DiscoveryPort = 7359
 
+// DiscoveryMessage is the payload of a Jellyfin client-discovery request
+const DiscoveryMessage = "Who is JellyfinServer?"
+
 // Log represents the severity of a log message
 type Log int
 
@@ -43,6 +50,60 @@ func (l Log) String() string {
 	}
 }
 
+// Name returns the lowercase level name used in configuration and JSON
+func (l Log) Name() string {
+	switch l {
+	case LogDebug:
+		return "debug"
+	case LogInfo:
+		return "info"
+	case LogWarn:
+		return "warn"
+	case LogError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes the level by name
+func (l Log) MarshalText() ([]byte, error) {
+	return []byte(l.Name()), nil
+}
+
+// LogFields are structured key/value pairs attached to a log record, such
+// as client_ip, server_id or request_id
+type LogFields map[string]string
+
+// LogRecord is a single structured log entry
+type LogRecord struct {
+	Time    time.Time `json:"time"`
+	Level   Log       `json:"level"`
+	Message string    `json:"message"`
+	Fields  LogFields `json:"fields,omitempty"`
+}
+
+// Text renders the record as a text log line with its fields appended as
+// key=value pairs in key order
+func (lr LogRecord) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] %s | %s", lr.Time.Format("2006-01-02 15:04:05"), lr.Level.String(), lr.Message)
+
+	keys := make([]string, 0, len(lr.Fields))
+	for key := range lr.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := lr.Fields[key]
+		if value == "" || strings.ContainsAny(value, " =\"") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %s=%s", key, value)
+	}
+	return b.String()
+}
+
 // JellyfinDiscoveryResponse represents the Jellyfin Discovery Response JSON Format
 type JellyfinDiscoveryResponse struct {
 	Address         string      `json:"Address"`
@@ -65,38 +126,212 @@ type ServerInfoCache struct {
 	Mutex     sync.RWMutex
 }
 
-// DashboardData holds data for the dashboard template
+// DashboardData holds data for the dashboard template. Everything else on
+// the page is loaded from the JSON API.
 type DashboardData struct {
-	Version          string
-	ServerURL        string
-	ProxyURL         string
-	ProxyURLv6       string
-	LastRequestTime  string
-	LastRequestIP    string
-	TotalRequests    int64
-	CachedServerID   string
-	CachedServerName string
-	CacheAge         string
-	BlacklistedIPs   int
-	Logs             []string
-	Uptime           string
-}
-
-// LogBuffer holds recent log messages in memory
+	Version   string
+	BasePath  string
+	CSRFToken string
+}
+
+// StatusResponse is returned by /api/v1/status and combines every other
+// API resource
+type StatusResponse struct {
+	Version       string          `json:"version"`
+	StartedAt     time.Time       `json:"started_at"`
+	UptimeSeconds float64         `json:"uptime_seconds"`
+	Config        ConfigStatus    `json:"config"`
+	Server        ServerStatus    `json:"server"`
+	Stats         StatsStatus     `json:"stats"`
+	LogLevels     LogLevelsStatus `json:"log_levels"`
+}
+
+// ConfigStatus describes the active configuration
+type ConfigStatus struct {
+	ServerURL      string `json:"server_url"`
+	ProxyURL       string `json:"proxy_url"`
+	ProxyURLv6     string `json:"proxy_url_ipv6"`
+	BindIP         string `json:"bind_ip"`
+	BlacklistedIPs int    `json:"blacklisted_ips"`
+	MACRules       int    `json:"mac_rules"`
+}
+
+// ServerStatus describes the cached Jellyfin server info, returned by
+// /api/v1/server. Id, Name and CachedAt are null while the cache is empty.
+type ServerStatus struct {
+	Id                   *string    `json:"id"`
+	Name                 *string    `json:"name"`
+	CachedAt             *time.Time `json:"cached_at"`
+	CacheAgeSeconds      *float64   `json:"cache_age_seconds"`
+	CacheDurationSeconds float64    `json:"cache_duration_seconds"`
+}
+
+// StatsStatus describes request statistics, returned by /api/v1/stats
+type StatsStatus struct {
+	TotalRequests   int64      `json:"total_requests"`
+	LastRequestTime *time.Time `json:"last_request_time"`
+	LastRequestIP   *string    `json:"last_request_ip"`
+}
+
+// TimeSeriesResponse is returned by /api/v1/stats/timeseries, oldest
+// bucket first
+type TimeSeriesResponse struct {
+	Resolution      string       `json:"resolution"`
+	IntervalSeconds float64      `json:"interval_seconds"`
+	Points          []RateBucket `json:"points"`
+}
+
+// LogLevelsStatus describes the global log level and the effective level
+// of each component; Overrides lists components with their own level
+type LogLevelsStatus struct {
+	Global     string            `json:"global"`
+	Components map[string]string `json:"components"`
+	Overrides  []string          `json:"overrides"`
+}
+
+// LogsResponse is returned by /api/v1/logs
+type LogsResponse struct {
+	Logs []LogRecord `json:"logs"`
+}
+
+// LogBuffer holds recent log records in memory and fans new records out to
+// live subscribers
 type LogBuffer struct {
-	Messages []string
-	MaxSize  int
-	Mutex    sync.RWMutex
+	Records     []LogRecord
+	MaxSize     int
+	Subscribers map[chan LogRecord]bool
+	Mutex       sync.RWMutex
 }
 
+// LogSubscriberBuffer is how many records a slow subscriber may fall
+// behind before new records are dropped for it
+const LogSubscriberBuffer = 256
+
 // RequestStats tracks statistics about discovery requests
 type RequestStats struct {
 	LastRequestTime time.Time
 	LastRequestIP   string
 	TotalRequests   int64
+	PerMinute       *RateSeries
+	PerHour         *RateSeries
 	Mutex           sync.RWMutex
 }
 
+// RateEvent identifies what a RateSeries counts
+type RateEvent int
+
+// Rate events recorded for every discovery request
+const (
+	RateReceived RateEvent = iota
+	RateAnswered
+	RateBlocked
+	RateUpstreamFailure
+)
+
+// RateBucket holds the event counts for one interval
+type RateBucket struct {
+	Start            time.Time `json:"start"`
+	Received         int64     `json:"received"`
+	Answered         int64     `json:"answered"`
+	Blocked          int64     `json:"blocked"`
+	UpstreamFailures int64     `json:"upstream_failures"`
+}
+
+// RateSeries is a fixed-size ring of buckets, one per Interval. A slot is
+// reused once its bucket falls out of the window, so memory stays constant.
+type RateSeries struct {
+	Interval time.Duration
+	Buckets  []RateBucket
+	Mutex    sync.Mutex
+}
+
+// ClientIdentity describes who a client IP belongs to. MAC, Hostname and
+// Name are empty when unknown.
+type ClientIdentity struct {
+	IP       string `json:"ip"`
+	MAC      string `json:"mac"`
+	Hostname string `json:"hostname"`
+	Name     string `json:"name"`
+}
+
+// Format describes a client address for logs: addr followed by the
+// friendly name, hostname and MAC address when known
+func (ci ClientIdentity) Format(addr string) string {
+	var details []string
+	for _, detail := range []string{ci.Name, ci.Hostname, ci.MAC} {
+		if detail != "" {
+			details = append(details, detail)
+		}
+	}
+	if len(details) == 0 {
+		return addr
+	}
+	return addr + " (" + strings.Join(details, ", ") + ")"
+}
+
+// ClientInfo tracks discovery activity for a single client IP
+type ClientInfo struct {
+	IP        string    `json:"ip"`
+	MAC       string    `json:"mac"`
+	Hostname  string    `json:"hostname"`
+	Name      string    `json:"name"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Requests  int64     `json:"requests"`
+	Responses int64     `json:"responses"`
+	Blocked   int64     `json:"blocked"`
+	Ports     []int     `json:"ports"`
+}
+
+// MaxClientPorts is how many distinct recent source ports are kept per client
+const MaxClientPorts = 10
+
+// ListenerState tracks the discovery read loop for readiness checks. Each
+// loop started gets a new Generation so a loop that exits after a rebind
+// cannot mark its replacement as stopped.
+type ListenerState struct {
+	Address    string
+	Running    bool
+	Generation int
+	LastPoll   time.Time
+	LastError  string
+	Mutex      sync.RWMutex
+}
+
+// UpstreamHealth records the outcome of the most recent Jellyfin fetches
+type UpstreamHealth struct {
+	LastSuccess time.Time
+	LastFailure time.Time
+	LastError   string
+}
+
+// HookQueueStatus describes one hook's asynchronous run queue
+type HookQueueStatus struct {
+	Event        string `json:"event"`
+	Type         string `json:"type"`
+	Queued       int    `json:"queued"`
+	Active       int    `json:"active"`
+	Completed    uint64 `json:"completed"`
+	Failed       uint64 `json:"failed"`
+	Retried      uint64 `json:"retried"`
+	DeadLettered uint64 `json:"dead_lettered"`
+	Dropped      uint64 `json:"dropped"`
+}
+
+// ClientRegistry tracks every client seen by the listener, keyed by IP.
+// Entries idle for longer than Expiry are removed by Prune; zero keeps
+// them until restart.
+type ClientRegistry struct {
+	Clients map[string]*ClientInfo
+	Expiry  time.Duration
+	Mutex   sync.RWMutex
+}
+
+// ClientsResponse is returned by /api/v1/clients
+type ClientsResponse struct {
+	Clients []ClientInfo `json:"clients"`
+}
+
 // IPBlacklist manages blocked IP addresses and subnets
 type IPBlacklist struct {
 	IPs     map[string]bool
@@ -104,6 +339,16 @@ type IPBlacklist struct {
 	Mutex   sync.RWMutex
 }
 
+// MACFilter allows or denies clients by MAC address. A non-empty Allow set
+// admits only the listed devices; Deny always wins. Clients whose MAC cannot
+// be resolved (not on-link, stale neighbor entry) are admitted only when
+// AllowUnresolved is set.
+type MACFilter struct {
+	Allow           map[string]bool
+	Deny            map[string]bool
+	AllowUnresolved bool
+}
+
 // Config holds all configuration for the proxy.
 //
 // ServerURL is the single URL the proxy uses to fetch /System/Info/Public
@@ -111,17 +356,36 @@ type IPBlacklist struct {
 // clients. ProxyURLv6, when non-empty and different from ProxyURL, causes
 // a second response carrying the v6 URL to be sent so dual-stack clients
 // can pick whichever endpoint they can reach.
+//
+// HTTPBind is empty (all interfaces), an IP, or "unix:" followed by a
+// socket path. HTTPBasePath is empty or starts with "/" and has no trailing
+// slash. TLSCertFile and TLSKeyFile are both set or both empty.
 type Config struct {
 	ServerURL        string
 	ProxyURL         string
 	ProxyURLv6       string
 	NetworkInterface string
 	BindIP           string
+	HTTPEnabled      bool
+	HTTPBind         string
 	HTTPPort         string
+	HTTPBasePath     string
+	TrustedProxies   []*net.IPNet
+	TLSCertFile      string
+	TLSKeyFile       string
 }
 
 // ServerInfoCache methods
 
+// Snapshot returns the cached server info with its timestamp and duration,
+// whether or not it has expired
+func (c *ServerInfoCache) Snapshot() (*SystemInfoResponse, time.Time, time.Duration) {
+	c.Mutex.RLock()
+	defer c.Mutex.RUnlock()
+
+	return c.Info, c.Timestamp, c.Duration
+}
+
 // Get returns the cached ServerInfo or nil if cache is empty or expired
 func (c *ServerInfoCache) Get() *SystemInfoResponse {
 	c.Mutex.RLock()
@@ -143,26 +407,87 @@ func (c *ServerInfoCache) Set(info *SystemInfoResponse) {
 	c.Timestamp = time.Now()
 }
 
+// Age returns how long ago the cached server info was stored, and false
+// when the cache is empty
+func (c *ServerInfoCache) Age() (time.Duration, bool) {
+	c.Mutex.RLock()
+	defer c.Mutex.RUnlock()
+
+	if c.Info == nil {
+		return 0, false
+	}
+	return time.Since(c.Timestamp), true
+}
+
+// SetDuration changes how long cached server info stays valid
+func (c *ServerInfoCache) SetDuration(duration time.Duration) {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+
+	c.Duration = duration
+}
+
 // LogBuffer methods
 
-// Add adds a log message to the buffer
-func (lb *LogBuffer) Add(message string) {
+// Add adds a log record to the buffer
+func (lb *LogBuffer) Add(record LogRecord) {
 	lb.Mutex.Lock()
 	defer lb.Mutex.Unlock()
 
-	lb.Messages = append(lb.Messages, message)
-	if len(lb.Messages) > lb.MaxSize {
-		lb.Messages = lb.Messages[1:]
+	lb.Records = append(lb.Records, record)
+	if len(lb.Records) > lb.MaxSize {
+		lb.Records = lb.Records[1:]
+	}
+
+	// Never block logging on a slow subscriber
+	for ch := range lb.Subscribers {
+		select {
+		case ch <- record:
+		default:
+		}
 	}
 }
 
-// GetAll returns all log messages
-func (lb *LogBuffer) GetAll() []string {
+// SetMaxSize changes how many records are kept, dropping the oldest ones
+// when the buffer shrinks
+func (lb *LogBuffer) SetMaxSize(maxSize int) {
+	lb.Mutex.Lock()
+	defer lb.Mutex.Unlock()
+
+	lb.MaxSize = maxSize
+	if len(lb.Records) > maxSize {
+		lb.Records = append([]LogRecord(nil), lb.Records[len(lb.Records)-maxSize:]...)
+	}
+}
+
+// Subscribe returns a channel that receives every record added from now on
+func (lb *LogBuffer) Subscribe() chan LogRecord {
+	lb.Mutex.Lock()
+	defer lb.Mutex.Unlock()
+
+	ch := make(chan LogRecord, LogSubscriberBuffer)
+	if lb.Subscribers == nil {
+		lb.Subscribers = make(map[chan LogRecord]bool)
+	}
+	lb.Subscribers[ch] = true
+	return ch
+}
+
+// Unsubscribe stops delivering records to ch
+func (lb *LogBuffer) Unsubscribe(ch chan LogRecord) {
+	lb.Mutex.Lock()
+	defer lb.Mutex.Unlock()
+
+	delete(lb.Subscribers, ch)
+}
+
+// GetAll returns all log records
+func (lb *LogBuffer) GetAll() []LogRecord {
 	lb.Mutex.RLock()
 	defer lb.Mutex.RUnlock()
 
-	result := make([]string, len(lb.Messages))
-	copy(result, lb.Messages)
+	result := make([]LogRecord, len(lb.Records))
+	copy(result, lb.Records)
 	return result
 }
 
@@ -186,6 +511,212 @@ func (rs *RequestStats) GetStats() (time.Time, string, int64) {
 	return rs.LastRequestTime, rs.LastRequestIP, rs.TotalRequests
 }
 
+// RecordEvent counts an event in the per-minute and per-hour series
+func (rs *RequestStats) RecordEvent(event RateEvent) {
+	now := time.Now()
+	rs.PerMinute.Record(now, event)
+	rs.PerHour.Record(now, event)
+}
+
+// RateSeries methods
+
+// Record counts an event in the bucket covering now
+func (rs *RateSeries) Record(now time.Time, event RateEvent) {
+	rs.Mutex.Lock()
+	defer rs.Mutex.Unlock()
+
+	start := now.Truncate(rs.Interval)
+	bucket := &rs.Buckets[rs.slot(start)]
+	if !bucket.Start.Equal(start) {
+		*bucket = RateBucket{Start: start}
+	}
+
+	switch event {
+	case RateReceived:
+		bucket.Received++
+	case RateAnswered:
+		bucket.Answered++
+	case RateBlocked:
+		bucket.Blocked++
+	case RateUpstreamFailure:
+		bucket.UpstreamFailures++
+	}
+}
+
+// Points returns one bucket per interval for the whole window ending at
+// now, oldest first, with zero counts for intervals without events
+func (rs *RateSeries) Points(now time.Time) []RateBucket {
+	rs.Mutex.Lock()
+	defer rs.Mutex.Unlock()
+
+	current := now.Truncate(rs.Interval)
+	points := make([]RateBucket, len(rs.Buckets))
+	for i := range points {
+		start := current.Add(-time.Duration(len(points)-1-i) * rs.Interval)
+		bucket := rs.Buckets[rs.slot(start)]
+		if !bucket.Start.Equal(start) {
+			bucket = RateBucket{Start: start}
+		}
+		bucket.Start = bucket.Start.UTC()
+		points[i] = bucket
+	}
+	return points
+}
+
+// slot returns the ring index for the bucket starting at start
+func (rs *RateSeries) slot(start time.Time) int {
+	return int(start.Unix()/int64(rs.Interval/time.Second)) % len(rs.Buckets)
+}
+
+// ListenerState methods
+
+// Start marks a read loop on address as running and returns its generation
+func (ls *ListenerState) Start(address string) int {
+	ls.Mutex.Lock()
+	defer ls.Mutex.Unlock()
+
+	ls.Generation++
+	ls.Address = address
+	ls.Running = true
+	ls.LastPoll = time.Now()
+	ls.LastError = ""
+	return ls.Generation
+}
+
+// Poll records that the read loop returned from a read, with the error
+// when it was anything but a timeout
+func (ls *ListenerState) Poll(generation int, err error) {
+	ls.Mutex.Lock()
+	defer ls.Mutex.Unlock()
+
+	if generation != ls.Generation {
+		return
+	}
+	ls.LastPoll = time.Now()
+	ls.LastError = ""
+	if err != nil {
+		ls.LastError = err.Error()
+	}
+}
+
+// Stop marks the read loop as stopped unless a newer one has started
+func (ls *ListenerState) Stop(generation int) {
+	ls.Mutex.Lock()
+	defer ls.Mutex.Unlock()
+
+	if generation == ls.Generation {
+		ls.Running = false
+	}
+}
+
+// Status returns the listener address, whether it is running, when it last
+// returned from a read and the last read error
+func (ls *ListenerState) Status() (string, bool, time.Time, string) {
+	ls.Mutex.RLock()
+	defer ls.Mutex.RUnlock()
+
+	return ls.Address, ls.Running, ls.LastPoll, ls.LastError
+}
+
+// ClientRegistry methods
+
+// RecordRequest records a discovery request from the identified client's
+// source port, refreshing its MAC address, hostname and name
+func (cr *ClientRegistry) RecordRequest(identity ClientIdentity, port int) {
+	cr.Mutex.Lock()
+	defer cr.Mutex.Unlock()
+
+	now := time.Now()
+	client, ok := cr.Clients[identity.IP]
+	if !ok {
+		client = &ClientInfo{IP: identity.IP, FirstSeen: now}
+		cr.Clients[identity.IP] = client
+	}
+	client.LastSeen = now
+	client.Requests++
+	if identity.MAC != "" {
+		client.MAC = identity.MAC
+	}
+	if identity.Hostname != "" {
+		client.Hostname = identity.Hostname
+	}
+	client.Name = identity.Name
+
+	// Keep the most recent distinct ports, newest last
+	for i, p := range client.Ports {
+		if p == port {
+			client.Ports = append(client.Ports[:i], client.Ports[i+1:]...)
+			break
+		}
+	}
+	client.Ports = append(client.Ports, port)
+	if len(client.Ports) > MaxClientPorts {
+		client.Ports = client.Ports[len(client.Ports)-MaxClientPorts:]
+	}
+}
+
+// RecordResponse records a discovery response sent to ip
+func (cr *ClientRegistry) RecordResponse(ip string) {
+	cr.Mutex.Lock()
+	defer cr.Mutex.Unlock()
+
+	if client, ok := cr.Clients[ip]; ok {
+		client.Responses++
+	}
+}
+
+// RecordBlocked records a request from ip that was rejected by access rules
+func (cr *ClientRegistry) RecordBlocked(ip string) {
+	cr.Mutex.Lock()
+	defer cr.Mutex.Unlock()
+
+	if client, ok := cr.Clients[ip]; ok {
+		client.Blocked++
+	}
+}
+
+// GetAll returns a copy of every tracked client
+func (cr *ClientRegistry) GetAll() []ClientInfo {
+	cr.Mutex.RLock()
+	defer cr.Mutex.RUnlock()
+
+	result := make([]ClientInfo, 0, len(cr.Clients))
+	for _, client := range cr.Clients {
+		entry := *client
+		entry.Ports = append([]int(nil), client.Ports...)
+		result = append(result, entry)
+	}
+	return result
+}
+
+// SetExpiry changes how long idle clients are kept
+func (cr *ClientRegistry) SetExpiry(expiry time.Duration) {
+	cr.Mutex.Lock()
+	defer cr.Mutex.Unlock()
+
+	cr.Expiry = expiry
+}
+
+// Prune removes clients idle for longer than Expiry and returns how many
+// were removed
+func (cr *ClientRegistry) Prune() int {
+	cr.Mutex.Lock()
+	defer cr.Mutex.Unlock()
+
+	if cr.Expiry == 0 {
+		return 0
+	}
+
+	removed := 0
+	for ip, client := range cr.Clients {
+		if time.Since(client.LastSeen) > cr.Expiry {
+			delete(cr.Clients, ip)
+			removed++
+		}
+	}
+	return removed
+}
+
 // IPBlacklist methods
 
 // IsBlocked checks if an IP is blacklisted (either as individual IP or within a subnet)
@@ -221,3 +752,34 @@ func (bl *IPBlacklist) Count() int {
 
 	return len(bl.IPs) + len(bl.Subnets)
 }
+
+// MACFilter methods
+
+// Active reports whether any MAC rules are configured
+func (mf *MACFilter) Active() bool {
+	return len(mf.Allow) > 0 || len(mf.Deny) > 0
+}
+
+// Evaluate decides whether a client with the given MAC address (empty when
+// unresolved) may be answered. resolved is false when rules are configured
+// but the MAC was unknown, so the fail-open/fail-closed choice decided.
+func (mf *MACFilter) Evaluate(mac string) (allowed bool, resolved bool) {
+	if !mf.Active() {
+		return true, true
+	}
+	if mac == "" {
+		return mf.AllowUnresolved, false
+	}
+	if mf.Deny[mac] {
+		return false, true
+	}
+	if len(mf.Allow) > 0 && !mf.Allow[mac] {
+		return false, true
+	}
+	return true, true
+}
+
+// Count returns the total number of MAC rules
+func (mf *MACFilter) Count() int {
+	return len(mf.Allow) + len(mf.Deny)
+}
@@ -0,0 +1,70 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateSeries(t *testing.T) {
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	type event struct {
+		offset time.Duration
+		kind   RateEvent
+	}
+	tests := []struct {
+		name   string
+		events []event
+		now    time.Duration
+		// want holds the received and blocked counts per point, oldest first
+		want [][2]int64
+	}{
+		{
+			name: "empty window",
+			now:  0,
+			want: [][2]int64{{0, 0}, {0, 0}, {0, 0}},
+		},
+		{
+			name:   "events land in their interval",
+			events: []event{{0, RateReceived}, {30 * time.Second, RateReceived}, {time.Minute, RateBlocked}},
+			now:    time.Minute + 59*time.Second,
+			want:   [][2]int64{{0, 0}, {2, 0}, {0, 1}},
+		},
+		{
+			name:   "old buckets fall out of the window",
+			events: []event{{0, RateReceived}, {time.Minute, RateReceived}},
+			now:    3 * time.Minute,
+			want:   [][2]int64{{1, 0}, {0, 0}, {0, 0}},
+		},
+		{
+			name:   "reused slot starts from zero",
+			events: []event{{0, RateReceived}, {0, RateReceived}, {3 * time.Minute, RateBlocked}},
+			now:    3 * time.Minute,
+			want:   [][2]int64{{0, 0}, {0, 0}, {0, 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			series := &RateSeries{Interval: time.Minute, Buckets: make([]RateBucket, 3)}
+			for _, e := range tt.events {
+				series.Record(base.Add(e.offset), e.kind)
+			}
+
+			now := base.Add(tt.now)
+			points := series.Points(now)
+			if len(points) != len(tt.want) {
+				t.Fatalf("got %d points, want %d", len(points), len(tt.want))
+			}
+			for i, point := range points {
+				wantStart := now.Truncate(time.Minute).Add(-time.Duration(len(points)-1-i) * time.Minute)
+				if !point.Start.Equal(wantStart) {
+					t.Errorf("point %d starts at %v, want %v", i, point.Start, wantStart)
+				}
+				if got := [2]int64{point.Received, point.Blocked}; got != tt.want[i] {
+					t.Errorf("point %d (received, blocked) = %v, want %v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/clients"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/config"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/logging"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// StatusHandler returns an HTTP handler for /api/v1/status
+func StatusHandler(serverCache *types.ServerInfoCache, store *config.Store, stats *types.RequestStats, version string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, types.StatusResponse{
+			Version:       version,
+			StartedAt:     StartTime.UTC(),
+			UptimeSeconds: time.Since(StartTime).Seconds(),
+			Config:        buildConfigStatus(store.Get()),
+			Server:        buildServerStatus(serverCache),
+			Stats:         buildStatsStatus(stats),
+			LogLevels:     logging.Levels(),
+		})
+	}
+}
+
+// ServerHandler returns an HTTP handler for /api/v1/server
+func ServerHandler(serverCache *types.ServerInfoCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, buildServerStatus(serverCache))
+	}
+}
+
+// StatsHandler returns an HTTP handler for /api/v1/stats
+func StatsHandler(stats *types.RequestStats) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, buildStatsStatus(stats))
+	}
+}
+
+// TimeSeriesHandler returns an HTTP handler for /api/v1/stats/timeseries.
+// The resolution query parameter selects "minute" (the default, last hour)
+// or "hour" (last two days) buckets.
+func TimeSeriesHandler(stats *types.RequestStats) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resolution := r.URL.Query().Get("resolution")
+		var series *types.RateSeries
+		switch resolution {
+		case "", "minute":
+			resolution = "minute"
+			series = stats.PerMinute
+		case "hour":
+			series = stats.PerHour
+		default:
+			writeError(w, http.StatusBadRequest, "resolution must be 'minute' or 'hour'")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, types.TimeSeriesResponse{
+			Resolution:      resolution,
+			IntervalSeconds: series.Interval.Seconds(),
+			Points:          series.Points(time.Now()),
+		})
+	}
+}
+
+// ClientsHandler returns an HTTP handler for /api/v1/clients. Clients are
+// sorted by most recently seen first and carry their current friendly name.
+func ClientsHandler(registry *types.ClientRegistry, identifier *clients.Identifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entries := registry.GetAll()
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].LastSeen.After(entries[j].LastSeen)
+		})
+		for i := range entries {
+			entries[i].FirstSeen = entries[i].FirstSeen.UTC()
+			entries[i].LastSeen = entries[i].LastSeen.UTC()
+			entries[i].Name = identifier.NameFor(entries[i].IP, entries[i].MAC)
+		}
+		writeJSON(w, http.StatusOK, types.ClientsResponse{Clients: entries})
+	}
+}
+
+// ClientNameRequest sets or (with an empty name) removes a friendly name
+type ClientNameRequest struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+// ClientNamesResponse is returned by /api/v1/clients/names
+type ClientNamesResponse struct {
+	Names     map[string]string `json:"names"`
+	Persisted bool              `json:"persisted"`
+}
+
+// ClientNamesHandler returns an HTTP handler for /api/v1/clients/names.
+// GET lists the friendly-name mapping; PUT sets one entry keyed by MAC
+// address or IP.
+func ClientNamesHandler(identifier *clients.Identifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, ClientNamesResponse{Names: identifier.Names()})
+		case http.MethodPut:
+			var request ClientNameRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+				return
+			}
+			persisted, err := identifier.SetName(request.Key, strings.TrimSpace(request.Name))
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			writeJSON(w, http.StatusOK, ClientNamesResponse{Names: identifier.Names(), Persisted: persisted})
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// buildConfigStatus describes the active configuration snapshot
+func buildConfigStatus(snapshot *config.Snapshot) types.ConfigStatus {
+	return types.ConfigStatus{
+		ServerURL:      snapshot.Config.ServerURL,
+		ProxyURL:       snapshot.Config.ProxyURL,
+		ProxyURLv6:     snapshot.Config.ProxyURLv6,
+		BindIP:         snapshot.Config.BindIP,
+		BlacklistedIPs: snapshot.Blacklist.Count(),
+		MACRules:       snapshot.MACFilter.Count(),
+	}
+}
+
+// buildServerStatus describes the cached server info, leaving fields null
+// while the cache is empty or expired
+func buildServerStatus(serverCache *types.ServerInfoCache) types.ServerStatus {
+	_, cachedAt, duration := serverCache.Snapshot()
+	status := types.ServerStatus{
+		CacheDurationSeconds: duration.Seconds(),
+	}
+
+	if serverInfo := serverCache.Get(); serverInfo != nil {
+		cachedAt = cachedAt.UTC()
+		age := time.Since(cachedAt).Seconds()
+		status.Id = &serverInfo.Id
+		status.Name = &serverInfo.ServerName
+		status.CachedAt = &cachedAt
+		status.CacheAgeSeconds = &age
+	}
+	return status
+}
+
+// buildStatsStatus describes request statistics
+func buildStatsStatus(stats *types.RequestStats) types.StatsStatus {
+	lastReqTime, lastReqIP, totalReqs := stats.GetStats()
+	status := types.StatsStatus{
+		TotalRequests: totalReqs,
+	}
+
+	if !lastReqTime.IsZero() {
+		lastReqTime = lastReqTime.UTC()
+		status.LastRequestTime = &lastReqTime
+		status.LastRequestIP = &lastReqIP
+	}
+	return status
+}
+
+// ErrorResponse is returned by API endpoints on failure
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// writeJSON writes value as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError writes an ErrorResponse with the given status code
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, ErrorResponse{Error: message})
+}
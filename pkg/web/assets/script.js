@@ -1,4 +1,32 @@
 let refreshTime = Date.now();
+let clients = [];
+let clientSort = { key: 'last_seen', ascending: false };
+let rateResolution = 'minute';
+let logRecords = [];
+let logsPaused = false;
+let logsPending = 0;
+let logStream = null;
+
+// Path prefix the dashboard is served under, empty at the root.
+const basePath = document.querySelector('meta[name="base-path"]').content;
+
+// Token sent with state-changing requests when authentication is enabled.
+const csrfToken = document.querySelector('meta[name="csrf-token"]').content;
+
+// Log records kept in the browser while streaming.
+const maxLogRecords = 2000;
+
+// Log level names in order of severity, with their text-format markers.
+const logLevels = ['debug', 'info', 'warn', 'error'];
+const logMarkers = { debug: 'DEB', info: 'INF', warn: 'WRN', error: 'ERR' };
+
+// Series drawn on the request rate chart, in legend order.
+const rateSeries = [
+    { field: 'received', className: 'line-received' },
+    { field: 'answered', className: 'line-answered' },
+    { field: 'blocked', className: 'line-blocked' },
+    { field: 'upstream_failures', className: 'line-upstream' },
+];
 
 // updateTimer updates the elapsed time display.
 function updateTimer() {
@@ -16,10 +44,481 @@ function updateTimer() {
     document.getElementById('refresh-timer').textContent = 'Since last refresh: ' + timeStr;
 }
 
-// refreshPage reloads the current page.
+// formatDuration renders a number of seconds like Go's time.Duration.
+function formatDuration(totalSeconds) {
+    let seconds = Math.round(totalSeconds);
+    const hours = Math.floor(seconds / 3600);
+    seconds -= hours * 3600;
+    const minutes = Math.floor(seconds / 60);
+    seconds -= minutes * 60;
+
+    if (hours > 0) {
+        return hours + 'h' + minutes + 'm' + seconds + 's';
+    }
+    if (minutes > 0) {
+        return minutes + 'm' + seconds + 's';
+    }
+    return seconds + 's';
+}
+
+// formatTime renders an RFC3339 timestamp in local time.
+function formatTime(timestamp) {
+    return new Date(timestamp).toLocaleString();
+}
+
+// setText sets the text of an element, using fallback for null values.
+function setText(id, value, fallback) {
+    document.getElementById(id).textContent = value === null || value === '' ? fallback : value;
+}
+
+// fetchJSON requests an API endpoint and decodes the JSON body.
+async function fetchJSON(path) {
+    const response = await fetch(basePath + path, { headers: { 'Accept': 'application/json' } });
+    if (!response.ok) {
+        throw new Error(path + ' returned ' + response.status);
+    }
+    return response.json();
+}
+
+// renderStatus fills the page from an /api/v1/status response.
+function renderStatus(status) {
+    setText('uptime', formatDuration(status.uptime_seconds), '-');
+
+    setText('server-url', status.config.server_url, '-');
+    setText('proxy-url', status.config.proxy_url, '-');
+    setText('proxy-url-ipv6', status.config.proxy_url_ipv6, '(not set)');
+    setText('blacklisted-ips', status.config.blacklisted_ips, '0');
+
+    setText('server-name', status.server.name, 'N/A');
+    setText('server-id', status.server.id, 'N/A');
+    setText('cache-age', status.server.cache_age_seconds === null ? null : formatDuration(status.server.cache_age_seconds), 'N/A');
+
+    setText('last-request-time', status.stats.last_request_time === null ? null : formatTime(status.stats.last_request_time), 'Never');
+    setText('last-request-ip', status.stats.last_request_ip === null ? null : clientLabel(status.stats.last_request_ip), '');
+    setText('total-requests', status.stats.total_requests, '0');
+
+    renderLogLevels(status.log_levels);
+}
+
+// renderLogLevels shows the global log level and each component's level,
+// marking components with their own override.
+function renderLogLevels(levels) {
+    const parts = ['global: ' + levels.global];
+    Object.keys(levels.components).sort().forEach(function (component) {
+        const override = levels.overrides.indexOf(component) !== -1 ? ' *' : '';
+        parts.push(component + ': ' + levels.components[component] + override);
+    });
+    setText('log-levels', 'Log levels: ' + parts.join(' | '), '');
+}
+
+// logFieldText renders one record field as key=value, quoting values the
+// same way the proxy's text output does.
+function logFieldText(key, value) {
+    if (value === '' || /[ ="]/.test(value)) {
+        value = JSON.stringify(value);
+    }
+    return key + '=' + value;
+}
+
+// logText renders a record like the proxy's text log output.
+function logText(record) {
+    const time = new Date(record.time).toLocaleString();
+    let text = '[' + time + '] ' + (logMarkers[record.level] || '???') + ' | ' + record.message;
+    Object.keys(record.fields || {}).sort().forEach(function (key) {
+        text += ' ' + logFieldText(key, record.fields[key]);
+    });
+    return text;
+}
+
+// logVisible reports whether a record passes the level filter and search.
+function logVisible(record) {
+    const minimum = logLevels.indexOf(document.getElementById('log-level').value);
+    const search = document.getElementById('log-search').value.toLowerCase();
+    if (logLevels.indexOf(record.level) < minimum) {
+        return false;
+    }
+    return search === '' || logText(record).toLowerCase().indexOf(search) !== -1;
+}
+
+// appendLogRecord adds one record to the log window when it passes the
+// filters. Fields are shown as chips; clicking one filters by it.
+function appendLogRecord(logWindow, record) {
+    if (!logVisible(record)) {
+        return;
+    }
+    const div = document.createElement('div');
+    div.className = 'log-line log-' + record.level;
+    div.textContent = '[' + new Date(record.time).toLocaleString() + '] ' + (logMarkers[record.level] || '???') + ' | ' + record.message;
+    Object.keys(record.fields || {}).sort().forEach(function (key) {
+        const field = document.createElement('span');
+        field.className = 'log-field';
+        field.textContent = logFieldText(key, record.fields[key]);
+        field.title = 'Show only lines with this ' + key;
+        field.addEventListener('click', function () {
+            document.getElementById('log-search').value = field.textContent;
+            renderLogs();
+        });
+        div.append(' ', field);
+    });
+    logWindow.appendChild(div);
+}
+
+// renderLogs redraws the log window from the records received so far.
+function renderLogs() {
+    const logWindow = document.getElementById('log-window');
+    logWindow.replaceChildren();
+    logRecords.forEach(function (record) {
+        appendLogRecord(logWindow, record);
+    });
+    logWindow.scrollTop = logWindow.scrollHeight;
+}
+
+// receiveLogRecord records a streamed log record, showing it unless paused.
+function receiveLogRecord(record) {
+    logRecords.push(record);
+    if (logRecords.length > maxLogRecords) {
+        logRecords.shift();
+    }
+    if (logsPaused) {
+        logsPending++;
+        document.getElementById('log-pause').textContent = 'Resume (' + logsPending + ' new)';
+        return;
+    }
+
+    const logWindow = document.getElementById('log-window');
+    const pinned = logWindow.scrollTop + logWindow.clientHeight >= logWindow.scrollHeight - 5;
+    appendLogRecord(logWindow, record);
+    while (logWindow.childElementCount > maxLogRecords) {
+        logWindow.removeChild(logWindow.firstChild);
+    }
+    if (pinned) {
+        logWindow.scrollTop = logWindow.scrollHeight;
+    }
+}
+
+// toggleLogPause pauses or resumes the live log view. Lines keep arriving
+// while paused and are shown on resume.
+function toggleLogPause() {
+    logsPaused = !logsPaused;
+    logsPending = 0;
+    const button = document.getElementById('log-pause');
+    button.textContent = logsPaused ? 'Resume' : 'Pause';
+    button.classList.toggle('active', logsPaused);
+    if (!logsPaused) {
+        renderLogs();
+    }
+}
+
+// connectLogStream loads the buffered logs and then follows new lines over
+// Server-Sent Events. The browser reconnects automatically; on reconnect the
+// buffer is reloaded so nothing logged in between is missed.
+async function connectLogStream() {
+    const status = document.getElementById('log-stream-status');
+    if (logStream !== null) {
+        logStream.close();
+    }
+
+    logStream = new EventSource(basePath + '/api/v1/logs/stream');
+    logStream.onopen = async function () {
+        status.textContent = 'Live';
+        status.className = 'stream-status live';
+        try {
+            const logs = await fetchJSON('/api/v1/logs');
+            logRecords = logs.logs.slice(-maxLogRecords);
+            renderLogs();
+        } catch (err) {
+            status.textContent = 'Failed to load logs';
+        }
+    };
+    logStream.onmessage = function (event) {
+        receiveLogRecord(JSON.parse(event.data));
+    };
+    logStream.onerror = function () {
+        status.textContent = 'Reconnecting...';
+        status.className = 'stream-status';
+    };
+}
+
+// renderRateChart draws an /api/v1/stats/timeseries response as one SVG
+// polyline per series, scaled to the busiest bucket.
+function renderRateChart(timeseries) {
+    const svg = document.getElementById('rate-chart');
+    const width = 800;
+    const height = 200;
+    const points = timeseries.points;
+    svg.replaceChildren();
+
+    let peak = 0;
+    points.forEach(function (point) {
+        rateSeries.forEach(function (series) {
+            peak = Math.max(peak, point[series.field]);
+        });
+    });
+    const scale = peak === 0 ? 0 : (height - 10) / peak;
+    const step = points.length > 1 ? width / (points.length - 1) : width;
+
+    rateSeries.forEach(function (series) {
+        const line = document.createElementNS('http://www.w3.org/2000/svg', 'polyline');
+        line.setAttribute('class', series.className);
+        line.setAttribute('points', points.map(function (point, i) {
+            return (i * step).toFixed(1) + ',' + (height - point[series.field] * scale).toFixed(1);
+        }).join(' '));
+        svg.appendChild(line);
+    });
+
+    const unit = timeseries.resolution === 'hour' ? 'hour' : 'minute';
+    setText('rate-chart-start', points.length ? formatTime(points[0].start) : null, '-');
+    setText('rate-chart-peak', 'Peak: ' + peak + ' per ' + unit, '-');
+    setText('rate-chart-end', 'Now', '-');
+}
+
+// setRateResolution switches the request rate chart between minute and
+// hour buckets.
+async function setRateResolution(resolution) {
+    rateResolution = resolution;
+    document.querySelectorAll('#rate-resolution .toggle-button').forEach(function (button) {
+        button.classList.toggle('active', button.dataset.resolution === resolution);
+    });
+    renderRateChart(await fetchJSON('/api/v1/stats/timeseries?resolution=' + resolution));
+}
+
+// compareClients orders two clients by the current sort column.
+function compareClients(a, b) {
+    let left = a[clientSort.key] === null ? '' : a[clientSort.key];
+    let right = b[clientSort.key] === null ? '' : b[clientSort.key];
+    if (clientSort.key === 'ip') {
+        left = left.split('.').map(function (part) { return part.padStart(3, '0'); }).join('.');
+        right = right.split('.').map(function (part) { return part.padStart(3, '0'); }).join('.');
+    }
+    if (left < right) {
+        return clientSort.ascending ? -1 : 1;
+    }
+    if (left > right) {
+        return clientSort.ascending ? 1 : -1;
+    }
+    return 0;
+}
+
+// renderClients fills the clients table, sorted by the current column.
+function renderClients() {
+    const body = document.getElementById('clients-body');
+    body.replaceChildren();
+
+    if (clients.length === 0) {
+        const row = body.insertRow();
+        const cell = row.insertCell();
+        cell.colSpan = 10;
+        cell.className = 'empty-row';
+        cell.textContent = 'No clients seen yet';
+        return;
+    }
+
+    clients.slice().sort(compareClients).forEach(function (client) {
+        const row = body.insertRow();
+
+        const nameCell = row.insertCell();
+        const nameText = document.createElement('span');
+        nameText.textContent = client.name || '-';
+        const editButton = document.createElement('button');
+        editButton.className = 'inline-button';
+        editButton.textContent = 'Edit';
+        editButton.title = 'Set a friendly name for this client';
+        editButton.addEventListener('click', function () {
+            editClientName(client);
+        });
+        nameCell.append(nameText, ' ', editButton);
+
+        [
+            client.ip,
+            client.mac || '-',
+            client.hostname || '-',
+            formatTime(client.first_seen),
+            formatTime(client.last_seen),
+            client.requests,
+            client.responses,
+            client.blocked,
+            client.ports.join(', '),
+        ].forEach(function (value) {
+            row.insertCell().textContent = value;
+        });
+    });
+
+    document.querySelectorAll('#clients-table th[data-sort]').forEach(function (th) {
+        th.classList.toggle('sorted-asc', th.dataset.sort === clientSort.key && clientSort.ascending);
+        th.classList.toggle('sorted-desc', th.dataset.sort === clientSort.key && !clientSort.ascending);
+    });
+}
+
+// editClientName prompts for a friendly name and saves it, keyed by MAC
+// address when known so the name follows the device across IP changes.
+async function editClientName(client) {
+    const key = client.mac || client.ip;
+    const name = prompt('Friendly name for ' + key + ' (leave empty to remove):', client.name);
+    if (name === null) {
+        return;
+    }
+
+    const response = await fetch(basePath + '/api/v1/clients/names', {
+        method: 'PUT',
+        headers: { 'Content-Type': 'application/json', 'X-CSRF-Token': csrfToken },
+        body: JSON.stringify({ key: key, name: name }),
+    });
+    if (!response.ok) {
+        const body = await response.json().catch(function () { return {}; });
+        alert('Failed to save name: ' + (body.error || response.status));
+        return;
+    }
+    loadDashboard();
+}
+
+// serverLabel describes a cached server identity from a cache action.
+function serverLabel(server) {
+    return server ? server.name + ' (' + server.id + ')' : 'nothing cached';
+}
+
+// cacheAction clears the server info cache or refreshes it from Jellyfin
+// and shows what changed.
+async function cacheAction(action) {
+    const result = document.getElementById('cache-result');
+    const response = await fetch(basePath + '/api/v1/admin/cache/' + action, {
+        method: 'POST',
+        headers: { 'X-CSRF-Token': csrfToken },
+    });
+    const body = await response.json().catch(function () { return {}; });
+
+    if (!response.ok) {
+        result.textContent = 'Cache ' + action + ' failed: ' + (body.error || response.status);
+    } else if (action === 'invalidate') {
+        result.textContent = 'Cache cleared (was ' + serverLabel(body.previous) + '); the next discovery request fetches fresh info.';
+    } else if (body.changed) {
+        result.textContent = 'Server info updated: ' + serverLabel(body.previous) + ' \u2192 ' + serverLabel(body.current);
+    } else {
+        result.textContent = 'Server info unchanged: ' + serverLabel(body.current);
+    }
+    result.hidden = false;
+    loadDashboard();
+}
+
+// Labels for the advertised URL a test discovery response carries.
+const responseKinds = {
+    primary: 'Primary',
+    ipv6: 'IPv6',
+    hostname_resolved: 'Hostname resolved to IP',
+    unknown: 'Unparsed',
+};
+
+// runDiscoveryTest sends a discovery request to the running listener and
+// lists every response exactly as a client receives it.
+async function runDiscoveryTest() {
+    const button = document.getElementById('discovery-test-button');
+    const status = document.getElementById('discovery-test-status');
+    const results = document.getElementById('discovery-test-results');
+    button.disabled = true;
+    status.textContent = 'Waiting for responses...';
+    results.replaceChildren();
+
+    try {
+        const response = await fetch(basePath + '/api/v1/admin/discovery-test', {
+            method: 'POST',
+            headers: { 'X-CSRF-Token': csrfToken },
+        });
+        const body = await response.json().catch(function () { return {}; });
+        if (!response.ok) {
+            status.textContent = 'Test failed: ' + (body.error || response.status);
+            return;
+        }
+
+        status.textContent = 'Sent "' + body.message + '" to ' + body.target + ', ' + body.responses.length + ' response(s).';
+        (body.errors || []).forEach(function (message) {
+            const error = document.createElement('p');
+            error.className = 'error-message';
+            error.textContent = message;
+            results.appendChild(error);
+        });
+        body.responses.forEach(function (entry) {
+            const box = document.createElement('div');
+            box.className = 'probe-response';
+            const meta = document.createElement('div');
+            meta.className = 'probe-meta';
+            meta.textContent = (responseKinds[entry.kind] || entry.kind) + ' | from ' + entry.from + ' | ' + entry.latency_ms.toFixed(1) + ' ms';
+            if (entry.error) {
+                meta.textContent += ' | ' + entry.error;
+            }
+            const raw = document.createElement('pre');
+            raw.textContent = entry.raw;
+            box.append(meta, raw);
+            results.appendChild(box);
+        });
+    } finally {
+        button.disabled = false;
+        loadDashboard();
+    }
+}
+
+// clientLabel describes a client IP with its friendly name when known.
+function clientLabel(ip) {
+    const client = clients.find(function (c) { return c.ip === ip; });
+    if (client && client.name) {
+        return ip + ' (' + client.name + ')';
+    }
+    return ip;
+}
+
+// sortClients sorts the clients table by a column, toggling direction when
+// the column is already sorted.
+function sortClients(key) {
+    if (clientSort.key === key) {
+        clientSort.ascending = !clientSort.ascending;
+    } else {
+        // Text columns start A-Z, counters and times start with the largest
+        clientSort = { key: key, ascending: ['name', 'ip', 'mac', 'hostname'].indexOf(key) !== -1 };
+    }
+    renderClients();
+}
+
+// loadDashboard fetches the dashboard data from the JSON API.
+async function loadDashboard() {
+    const errorBox = document.getElementById('load-error');
+    try {
+        const [status, clientList, timeseries] = await Promise.all([
+            fetchJSON('/api/v1/status'),
+            fetchJSON('/api/v1/clients'),
+            fetchJSON('/api/v1/stats/timeseries?resolution=' + rateResolution),
+        ]);
+        clients = clientList.clients;
+        renderStatus(status);
+        renderClients();
+        renderRateChart(timeseries);
+        errorBox.hidden = true;
+    } catch (err) {
+        errorBox.textContent = 'Failed to load dashboard data: ' + err.message;
+        errorBox.hidden = false;
+    }
+    refreshTime = Date.now();
+    updateTimer();
+}
+
+// refreshPage reloads the dashboard data.
 function refreshPage() {
-    location.reload();
+    loadDashboard();
 }
 
+document.querySelectorAll('#clients-table th[data-sort]').forEach(function (th) {
+    th.addEventListener('click', function () {
+        sortClients(th.dataset.sort);
+    });
+});
+
+document.querySelectorAll('#rate-resolution .toggle-button').forEach(function (button) {
+    button.addEventListener('click', function () {
+        setRateResolution(button.dataset.resolution);
+    });
+});
+
+document.getElementById('log-level').addEventListener('change', renderLogs);
+document.getElementById('log-search').addEventListener('input', renderLogs);
+document.getElementById('log-pause').addEventListener('click', toggleLogPause);
+
 setInterval(updateTimer, 1000);
-updateTimer();
+loadDashboard();
+connectLogStream();
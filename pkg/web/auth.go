@@ -0,0 +1,126 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/auth"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/config"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// publicPaths are served without authentication so orchestrators can probe
+// the proxy
+var publicPaths = map[string]bool{
+	"/health": true,
+	"/livez":  true,
+	"/readyz": true,
+}
+
+// contextKey keys request context values set by this package
+type contextKey string
+
+// userKey holds the basic auth user of an authenticated request
+const userKey contextKey = "user"
+
+// RequireAuth protects every route except publicPaths when AUTH_USERS or
+// AUTH_API_TOKENS is set. Browsers authenticate with basic auth and must
+// send the session's CSRF token with state-changing requests; API clients
+// send a bearer token. Without authentication, state-changing requests from
+// another site's pages are still rejected by their Origin header.
+func RequireAuth(store *config.Store, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		authConfig := store.Get().Auth
+		if !authConfig.Enabled() {
+			if !isSafeMethod(r.Method) && !sameOrigin(r) {
+				writeError(w, http.StatusForbidden, "cross-origin request rejected")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if token, ok := bearerToken(r); ok {
+			if !authConfig.CheckToken(token) {
+				logger.Logf(types.LogWarn, "Rejected invalid API token from %s for %s", r.RemoteAddr, r.URL.Path)
+				writeError(w, http.StatusUnauthorized, "invalid API token")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, password, ok := r.BasicAuth()
+		if !ok || !authConfig.CheckPassword(user, password) {
+			if ok {
+				logger.Logf(types.LogWarn, "Rejected login for user '%s' from %s", user, r.RemoteAddr)
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="Jellyfin Discovery Proxy", charset="UTF-8"`)
+			writeError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		if !isSafeMethod(r.Method) && !auth.CheckCSRF(user, r.Header.Get("X-CSRF-Token")) {
+			logger.Logf(types.LogWarn, "Rejected %s %s from %s without a valid CSRF token", r.Method, r.URL.Path, r.RemoteAddr)
+			writeError(w, http.StatusForbidden, "missing or invalid CSRF token")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey, user)))
+	})
+}
+
+// csrfTokenFor returns the CSRF token for the request's dashboard session,
+// empty when the request was not authenticated with a password
+func csrfTokenFor(r *http.Request) string {
+	user, ok := r.Context().Value(userKey).(string)
+	if !ok {
+		return ""
+	}
+	return auth.CSRFToken(user)
+}
+
+// bearerToken extracts a bearer token from the Authorization header
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(header[7:]), true
+}
+
+// isSafeMethod reports whether a method does not change state
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// sameOrigin reports whether a request came from this server's own pages.
+// Requests without an Origin header (curl, scripts) are not from a browser
+// page and are allowed.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	return err == nil && parsed.Host == r.Host && parsed.Scheme == requestScheme(r)
+}
+
+// requestScheme returns the scheme the client used, as reported by a
+// trusted proxy or else by the connection itself
+func requestScheme(r *http.Request) string {
+	if r.URL.Scheme != "" {
+		return r.URL.Scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,99 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/config"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/server"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// ServerIdentity is the Jellyfin server Id and name held in the cache
+type ServerIdentity struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// CacheResponse is returned by the cache admin endpoints. Previous and
+// Current are null when the cache was or is empty; Changed reports whether
+// the server Id or name differs between them.
+type CacheResponse struct {
+	Previous *ServerIdentity `json:"previous"`
+	Current  *ServerIdentity `json:"current"`
+	Changed  bool            `json:"changed"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// CacheInvalidateHandler returns an HTTP handler for
+// /api/v1/admin/cache/invalidate. It empties the server info cache so the
+// next discovery request fetches fresh info. Only POST is accepted.
+func CacheInvalidateHandler(serverCache *types.ServerInfoCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		previous, _, _ := serverCache.Snapshot()
+		serverCache.Set(nil)
+		logger.Logln(types.LogInfo, "Server info cache invalidated by admin request")
+
+		writeJSON(w, http.StatusOK, cacheResponse(previous, nil))
+	}
+}
+
+// CacheRefreshHandler returns an HTTP handler for
+// /api/v1/admin/cache/refresh. It fetches server info from Jellyfin right
+// away and caches it; when the fetch fails the cache is left untouched and
+// 502 is returned. Only POST is accepted.
+func CacheRefreshHandler(serverCache *types.ServerInfoCache, store *config.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		previous, _, _ := serverCache.Snapshot()
+		serverInfo, err := server.FetchInfo(store.Get().Config.ServerURL)
+		if err != nil {
+			logger.Logf(types.LogWarn, "Server info refresh failed, keeping cached info: %v", err)
+			response := cacheResponse(previous, previous)
+			response.Error = err.Error()
+			writeJSON(w, http.StatusBadGateway, response)
+			return
+		}
+
+		serverCache.Set(serverInfo)
+		response := cacheResponse(previous, serverInfo)
+		if response.Changed && previous != nil {
+			logger.Logf(types.LogInfo, "Server info refreshed by admin request - ID: %s -> %s, Name: %s -> %s", previous.Id, serverInfo.Id, previous.ServerName, serverInfo.ServerName)
+		} else {
+			logger.Logf(types.LogInfo, "Server info refreshed by admin request - ID: %s, Name: %s", serverInfo.Id, serverInfo.ServerName)
+		}
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+// cacheResponse compares the server info before and after a cache action
+func cacheResponse(previous, current *types.SystemInfoResponse) CacheResponse {
+	response := CacheResponse{
+		Previous: serverIdentity(previous),
+		Current:  serverIdentity(current),
+	}
+	if response.Previous != nil && response.Current != nil {
+		response.Changed = *response.Previous != *response.Current
+	} else {
+		response.Changed = response.Previous != response.Current
+	}
+	return response
+}
+
+// serverIdentity extracts the Id and name from server info, nil when empty
+func serverIdentity(info *types.SystemInfoResponse) *ServerIdentity {
+	if info == nil {
+		return nil
+	}
+	return &ServerIdentity{Id: info.Id, Name: info.ServerName}
+}
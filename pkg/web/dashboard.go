@@ -2,10 +2,14 @@ package web
 
 import (
 	_ "embed"
+	"encoding/json"
+	"errors"
 	"html/template"
 	"net/http"
 	"time"
 
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/config"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/logging"
 	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
 )
 
@@ -24,60 +28,103 @@ var faviconICO []byte
 // StartTime holds the application start time for uptime calculation
 var StartTime time.Time
 
-// HealthCheckHandler handles health check requests
+// HealthCheckHandler handles liveness checks on /livez and /health. It
+// only shows the process is serving HTTP; see ReadinessHandler for whether
+// discovery actually works.
 func HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
 }
 
-// DashboardHandler returns an HTTP handler for the dashboard
-func DashboardHandler(serverCache *types.ServerInfoCache, serverURL, proxyURL, proxyURLv6 string, stats *types.RequestStats, blacklist *types.IPBlacklist, logBuffer *types.LogBuffer, version string) http.HandlerFunc {
+// DashboardHandler returns an HTTP handler for the dashboard page. The page
+// is a shell that script.js fills in from the JSON API.
+func DashboardHandler(version string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		lastReqTime, lastReqIP, totalReqs := stats.GetStats()
-
-		serverInfo := serverCache.Get()
-		cachedID := "N/A"
-		cachedName := "N/A"
-		cacheAge := "N/A"
-
-		if serverInfo != nil {
-			cachedID = serverInfo.Id
-			cachedName = serverInfo.ServerName
-			cacheAge = time.Since(serverCache.Timestamp).Round(time.Second).String()
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
 		}
 
-		lastReqTimeStr := "Never"
-		if !lastReqTime.IsZero() {
-			lastReqTimeStr = lastReqTime.Format("2006-01-02 15:04:05")
+		data := types.DashboardData{
+			Version:   version,
+			BasePath:  basePathFor(r),
+			CSRFToken: csrfTokenFor(r),
 		}
 
-		uptime := time.Since(StartTime).Round(time.Second).String()
-		logs := logBuffer.GetAll()
+		t := template.Must(template.New("dashboard").Parse(dashboardHTML))
+		w.Header().Set("Content-Type", "text/html")
+		t.Execute(w, data)
+	}
+}
+
+// ReloadResponse is returned by the reload endpoint
+type ReloadResponse struct {
+	Changes []string `json:"changes"`
+	Error   string   `json:"error,omitempty"`
+}
 
-		proxyURLv6Display := proxyURLv6
-		if proxyURLv6Display == "" {
-			proxyURLv6Display = "(not set)"
+// ReloadHandler returns an HTTP handler that re-reads configuration through
+// the given reload function. A rejected configuration answers 422 and a
+// failure applying it 500. Only POST is accepted.
+func ReloadHandler(reload func() ([]string, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
 		}
 
-		data := types.DashboardData{
-			Version:          version,
-			ServerURL:        serverURL,
-			ProxyURL:         proxyURL,
-			ProxyURLv6:       proxyURLv6Display,
-			LastRequestTime:  lastReqTimeStr,
-			LastRequestIP:    lastReqIP,
-			TotalRequests:    totalReqs,
-			CachedServerID:   cachedID,
-			CachedServerName: cachedName,
-			CacheAge:         cacheAge,
-			BlacklistedIPs:   blacklist.Count(),
-			Logs:             logs,
-			Uptime:           uptime,
+		response := ReloadResponse{Changes: []string{}}
+		status := http.StatusOK
+		changes, err := reload()
+		if err != nil {
+			response.Error = err.Error()
+			status = http.StatusInternalServerError
+			var invalid *config.InvalidError
+			if errors.As(err, &invalid) {
+				status = http.StatusUnprocessableEntity
+			}
+		}
+		if changes != nil {
+			response.Changes = changes
 		}
 
-		t := template.Must(template.New("dashboard").Parse(dashboardHTML))
-		w.Header().Set("Content-Type", "text/html")
-		t.Execute(w, data)
+		writeJSON(w, status, response)
+	}
+}
+
+// LogLevelRequest changes one log level; Component is "global" or a
+// component name and Level "default" removes a component's override
+type LogLevelRequest struct {
+	Component string `json:"component"`
+	Level     string `json:"level"`
+}
+
+// LogLevelsHandler returns an HTTP handler for /api/v1/admin/log-levels.
+// GET shows the current levels, PUT changes one and DELETE restores the
+// configured levels.
+func LogLevelsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var request LogLevelRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+				return
+			}
+			if err := logging.SetLevel(request.Component, request.Level); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		case http.MethodDelete:
+			logging.ResetLevels()
+		default:
+			w.Header().Set("Allow", "GET, PUT, DELETE")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeJSON(w, http.StatusOK, logging.Levels())
 	}
 }
 
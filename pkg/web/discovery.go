@@ -0,0 +1,99 @@
+package web
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/config"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/probe"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/server"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// discoveryTestTimeout outlasts an upstream fetch on a cache miss, so a
+// slow Jellyfin server is not reported as the proxy not answering
+const discoveryTestTimeout = server.FetchTimeout + 2*time.Second
+
+// discoveryTestIdle ends the test early once the listener stops replying;
+// all responses to one request are sent back to back
+const discoveryTestIdle = 250 * time.Millisecond
+
+// DiscoveryTestEntry is one response to a loopback discovery test. Kind
+// says which advertised URL it carries: "primary", "ipv6",
+// "hostname_resolved" (the IP variant sent for a hostname URL) or
+// "unknown".
+type DiscoveryTestEntry struct {
+	probe.Response
+	Kind string `json:"kind"`
+}
+
+// DiscoveryTestResponse is returned by the discovery test endpoint
+type DiscoveryTestResponse struct {
+	Target    string               `json:"target"`
+	Message   string               `json:"message"`
+	TimeoutMs float64              `json:"timeout_ms"`
+	Responses []DiscoveryTestEntry `json:"responses"`
+	Errors    []string             `json:"errors,omitempty"`
+}
+
+// DiscoveryTestHandler returns an HTTP handler for
+// /api/v1/admin/discovery-test. It sends a discovery request to the
+// running listener over loopback (or its bound interface address) and
+// returns every response exactly as a client would receive it. The test is
+// handled like any other request, so it runs hooks, is counted in
+// statistics and is subject to the access rules. Only POST is accepted.
+func DiscoveryTestHandler(store *config.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		cfg := store.Get().Config
+		host := cfg.BindIP
+		if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+			host = "127.0.0.1"
+		}
+		target := net.JoinHostPort(host, strconv.Itoa(types.DiscoveryPort))
+
+		result, err := probe.Run([]string{target}, types.DiscoveryMessage, discoveryTestTimeout, discoveryTestIdle)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		response := DiscoveryTestResponse{
+			Target:    target,
+			Message:   result.Message,
+			TimeoutMs: result.TimeoutMs,
+			Responses: []DiscoveryTestEntry{},
+			Errors:    result.Errors,
+		}
+		for _, entry := range result.Responses {
+			response.Responses = append(response.Responses, DiscoveryTestEntry{Response: entry, Kind: responseKind(cfg, entry)})
+		}
+		if len(response.Responses) == 0 && len(response.Errors) == 0 {
+			response.Errors = append(response.Errors, "no response from the listener within the timeout; check the logs, BLACKLIST and MAC rules (they apply to this test too) and that Jellyfin is reachable")
+		}
+		logger.Logf(types.LogInfo, "Discovery test to %s received %d response(s)", target, len(response.Responses))
+
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+// responseKind matches a response's Address against the advertised URLs
+func responseKind(cfg *types.Config, response probe.Response) string {
+	if response.Parsed == nil {
+		return "unknown"
+	}
+	switch response.Parsed.Address {
+	case cfg.ProxyURL:
+		return "primary"
+	case cfg.ProxyURLv6:
+		return "ipv6"
+	}
+	return "hostname_resolved"
+}
@@ -0,0 +1,100 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/server"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// listenerStallAfter is how long the read loop may go without returning
+// from a read before it counts as stalled. Reads time out every second.
+const listenerStallAfter = 5 * time.Second
+
+// ReadinessCheck is the outcome of one readiness check
+type ReadinessCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// ReadinessResponse is returned by /readyz
+type ReadinessResponse struct {
+	Ready  bool             `json:"ready"`
+	Checks []ReadinessCheck `json:"checks"`
+}
+
+// ReadinessHandler returns an HTTP handler for /readyz. It answers 200 when
+// the discovery listener is reading and server info can be served from the
+// cache or Jellyfin, and 503 otherwise, describing each check in the body.
+func ReadinessHandler(listener *types.ListenerState, serverCache *types.ServerInfoCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := ReadinessResponse{
+			Ready: true,
+			Checks: []ReadinessCheck{
+				checkListener(listener),
+				checkUpstream(serverCache, server.Health()),
+			},
+		}
+		status := http.StatusOK
+		for _, check := range response.Checks {
+			if !check.OK {
+				response.Ready = false
+				status = http.StatusServiceUnavailable
+			}
+		}
+		writeJSON(w, status, response)
+	}
+}
+
+// checkListener passes while the discovery read loop is running and has
+// returned from a read recently without an error
+func checkListener(listener *types.ListenerState) ReadinessCheck {
+	check := ReadinessCheck{Name: "listener"}
+	address, running, lastPoll, lastError := listener.Status()
+	switch {
+	case address == "":
+		check.Detail = "UDP listener has not started"
+	case !running:
+		check.Detail = fmt.Sprintf("UDP listener on %s has stopped", address)
+	case lastError != "":
+		check.Detail = fmt.Sprintf("UDP listener on %s failed to read: %s", address, lastError)
+	case time.Since(lastPoll) > listenerStallAfter:
+		check.Detail = fmt.Sprintf("UDP listener on %s has not read for %v", address, time.Since(lastPoll).Round(time.Second))
+	default:
+		check.OK = true
+		check.Detail = fmt.Sprintf("reading on %s", address)
+	}
+	return check
+}
+
+// checkUpstream passes while valid server info is cached, or the cache is
+// empty but the latest Jellyfin fetch succeeded so the next request can
+// fill it. It fails when the cache is empty and Jellyfin was unreachable.
+func checkUpstream(serverCache *types.ServerInfoCache, health types.UpstreamHealth) ReadinessCheck {
+	check := ReadinessCheck{Name: "upstream"}
+	failing := health.LastFailure.After(health.LastSuccess)
+
+	if info := serverCache.Get(); info != nil {
+		age, _ := serverCache.Age()
+		check.OK = true
+		check.Detail = fmt.Sprintf("serving cached info for %s (age %v)", info.ServerName, age.Round(time.Second))
+		if failing {
+			check.Detail += fmt.Sprintf("; last Jellyfin fetch failed %v ago: %s", time.Since(health.LastFailure).Round(time.Second), health.LastError)
+		}
+		return check
+	}
+
+	switch {
+	case failing:
+		check.Detail = fmt.Sprintf("no cached server info and Jellyfin unreachable since %s: %s", health.LastFailure.UTC().Format(time.RFC3339), health.LastError)
+	case health.LastSuccess.IsZero():
+		check.Detail = "no cached server info and Jellyfin has not been contacted yet"
+	default:
+		check.OK = true
+		check.Detail = fmt.Sprintf("cache expired; last Jellyfin fetch succeeded %v ago", time.Since(health.LastSuccess).Round(time.Second))
+	}
+	return check
+}
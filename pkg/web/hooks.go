@@ -0,0 +1,132 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/config"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/hooks"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// HooksResponse is returned by /api/v1/hooks
+type HooksResponse struct {
+	QueueSize   int                     `json:"queue_size"`
+	Concurrency int                     `json:"concurrency"`
+	Queues      []types.HookQueueStatus `json:"queues"`
+}
+
+// HooksHandler returns an HTTP handler for /api/v1/hooks, describing the
+// dispatcher limits and each hook's queue
+func HooksHandler(store *config.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dispatch := store.Get().HookDispatch
+		writeJSON(w, http.StatusOK, HooksResponse{
+			QueueSize:   dispatch.QueueSize,
+			Concurrency: dispatch.Concurrency,
+			Queues:      hooks.QueueStatus(),
+		})
+	}
+}
+
+// DeadLettersResponse is returned by /api/v1/admin/hooks/dead-letters
+type DeadLettersResponse struct {
+	Entries []hooks.DeadLetter `json:"entries"`
+	Deleted int                `json:"deleted,omitempty"`
+}
+
+// ReplayRequest selects dead-lettered hook runs to replay; no IDs selects
+// every entry
+type ReplayRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// ReplayResponse is returned by /api/v1/admin/hooks/dead-letters/replay.
+// Stale lists selected entries whose hook is no longer configured.
+type ReplayResponse struct {
+	Replayed  int      `json:"replayed"`
+	Stale     []string `json:"stale"`
+	Remaining int      `json:"remaining"`
+}
+
+// DeadLettersHandler returns an HTTP handler for
+// /api/v1/admin/hooks/dead-letters. GET lists the dead-lettered hook runs;
+// DELETE removes the entries named by id query parameters, or all of them.
+func DeadLettersHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			entries, err := hooks.DeadLetters()
+			if err != nil {
+				writeDeadLetterError(w, err)
+				return
+			}
+			if entries == nil {
+				entries = []hooks.DeadLetter{}
+			}
+			writeJSON(w, http.StatusOK, DeadLettersResponse{Entries: entries})
+		case http.MethodDelete:
+			deleted, err := hooks.DeleteDeadLetters(r.URL.Query()["id"])
+			if err != nil {
+				writeDeadLetterError(w, err)
+				return
+			}
+			entries, err := hooks.DeadLetters()
+			if err != nil {
+				writeDeadLetterError(w, err)
+				return
+			}
+			if entries == nil {
+				entries = []hooks.DeadLetter{}
+			}
+			writeJSON(w, http.StatusOK, DeadLettersResponse{Entries: entries, Deleted: deleted})
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// DeadLetterReplayHandler returns an HTTP handler for
+// /api/v1/admin/hooks/dead-letters/replay. It queues the selected
+// dead-lettered runs again; an empty body replays all of them. Only POST
+// is accepted.
+func DeadLetterReplayHandler(store *config.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		var request ReplayRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+			writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+			return
+		}
+
+		result, err := hooks.ReplayDeadLetters(store.Get().Hooks, request.IDs)
+		if err != nil {
+			writeDeadLetterError(w, err)
+			return
+		}
+		logger.Logf(types.LogInfo, "Replayed %d dead-lettered hook run(s) by admin request, %d remaining", result.Replayed, result.Remaining)
+		response := ReplayResponse{Replayed: result.Replayed, Stale: result.Stale, Remaining: result.Remaining}
+		if response.Stale == nil {
+			response.Stale = []string{}
+		}
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+// writeDeadLetterError reports a dead-letter failure, answering 404 when
+// no dead-letter file is configured
+func writeDeadLetterError(w http.ResponseWriter, err error) {
+	if errors.Is(err, hooks.ErrNoDeadLetterFile) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
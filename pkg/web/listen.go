@@ -0,0 +1,55 @@
+package web
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// Listen opens the dashboard listener for cfg. HTTPBind selects an IP
+// (all interfaces when empty) combined with HTTPPort, or a unix socket when
+// it starts with "unix:". A stale socket left by an earlier run is removed
+// first; the socket file is removed again when the listener closes.
+func Listen(cfg *types.Config) (net.Listener, error) {
+	if path := strings.TrimPrefix(cfg.HTTPBind, "unix:"); path != cfg.HTTPBind {
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			logger.Logf(types.LogDebug, "Removing stale unix socket %s", path)
+			os.Remove(path)
+		}
+		listener, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on unix socket '%s': %v", path, err)
+		}
+		return listener, nil
+	}
+
+	address := net.JoinHostPort(cfg.HTTPBind, cfg.HTTPPort)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %v", address, err)
+	}
+	return listener, nil
+}
+
+// DisplayURL describes where the dashboard can be reached, for log messages
+func DisplayURL(cfg *types.Config) string {
+	if strings.HasPrefix(cfg.HTTPBind, "unix:") {
+		if cfg.HTTPBasePath != "" {
+			return fmt.Sprintf("%s (path %s/)", cfg.HTTPBind, cfg.HTTPBasePath)
+		}
+		return cfg.HTTPBind
+	}
+
+	scheme := "http"
+	if cfg.TLSCertFile != "" {
+		scheme = "https"
+	}
+	host := cfg.HTTPBind
+	if host == "" || net.ParseIP(host).IsUnspecified() {
+		host = "localhost"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(host, cfg.HTTPPort), cfg.HTTPBasePath)
+}
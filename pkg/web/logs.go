@@ -0,0 +1,152 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/logging"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// logStreamKeepAlive is how often an idle log stream sends a comment so
+// proxies do not time the connection out
+const logStreamKeepAlive = 15 * time.Second
+
+// logFilter selects log records by minimum level, text and field values
+type logFilter struct {
+	level  types.Log
+	search string
+	fields map[string]string
+}
+
+// parseLogFilter reads a filter from query parameters: level (minimum
+// level), q (case-insensitive text search) and any other parameter except
+// limit as an exact field match, e.g. client_ip=192.168.1.20
+func parseLogFilter(query url.Values) (logFilter, error) {
+	filter := logFilter{
+		level:  types.LogDebug,
+		search: strings.ToLower(query.Get("q")),
+		fields: make(map[string]string),
+	}
+
+	if levelStr := query.Get("level"); levelStr != "" {
+		level, ok := logging.ParseLevel(levelStr)
+		if !ok {
+			return filter, fmt.Errorf("unknown level '%s'", levelStr)
+		}
+		filter.level = level
+	}
+
+	for key, values := range query {
+		switch key {
+		case "level", "q", "limit":
+		default:
+			filter.fields[key] = values[0]
+		}
+	}
+	return filter, nil
+}
+
+// matches reports whether a record passes the filter
+func (f logFilter) matches(record types.LogRecord) bool {
+	if record.Level < f.level {
+		return false
+	}
+	for key, value := range f.fields {
+		if record.Fields[key] != value {
+			return false
+		}
+	}
+	return f.search == "" || strings.Contains(strings.ToLower(record.Text()), f.search)
+}
+
+// LogsHandler returns an HTTP handler for /api/v1/logs. Records can be
+// filtered with level, q and field parameters; the optional limit returns
+// only the most recent matches.
+func LogsHandler(logBuffer *types.LogBuffer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseLogFilter(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		logs := []types.LogRecord{}
+		for _, record := range logBuffer.GetAll() {
+			if filter.matches(record) {
+				logs = append(logs, record)
+			}
+		}
+
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			limit, err := strconv.Atoi(limitStr)
+			if err != nil || limit < 0 {
+				writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+				return
+			}
+			if limit < len(logs) {
+				logs = logs[len(logs)-limit:]
+			}
+		}
+		writeJSON(w, http.StatusOK, types.LogsResponse{Logs: logs})
+	}
+}
+
+// LogStreamHandler returns an HTTP handler for /api/v1/logs/stream, which
+// sends each new log record as a JSON Server-Sent Event. It accepts the same
+// filters as LogsHandler. Streams end when the client disconnects or done is
+// closed.
+func LogStreamHandler(logBuffer *types.LogBuffer, done <-chan struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, "streaming not supported")
+			return
+		}
+		filter, err := parseLogFilter(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		records := logBuffer.Subscribe()
+		defer logBuffer.Unsubscribe(records)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(logStreamKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case record := <-records:
+				if !filter.matches(record) {
+					continue
+				}
+				// JSON encoding escapes newlines, so each event is one data line
+				data, err := json.Marshal(record)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "data: %s\n\n", data)
+				flusher.Flush()
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			case <-done:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/metrics"
+)
+
+// MetricsHandler serves every registered metric in the Prometheus text format
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.WriteText(w)
+}
@@ -0,0 +1,44 @@
+package web
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/logging"
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// logger tags this package's log records with the web component
+var logger = logging.Component("web")
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// Flush passes flushes through so log streaming keeps working
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// LogRequests logs every HTTP request at debug level with its status code
+// and duration
+func LogRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		logger.WithFields(types.LogFields{"remote_addr": r.RemoteAddr}).Logf(types.LogDebug,
+			"HTTP %s %s -> %d (%v)", r.Method, r.URL.RequestURI(), recorder.status, time.Since(start).Round(time.Microsecond))
+	})
+}
@@ -0,0 +1,129 @@
+package web
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/config"
+)
+
+// basePathKey holds the HTTP_BASE_PATH a request was served under
+const basePathKey contextKey = "basePath"
+
+// ProxyHeaders applies X-Forwarded-For, X-Forwarded-Host and
+// X-Forwarded-Proto from requests whose peer is in TRUSTED_PROXIES, so logs
+// and authentication see the real client. The headers of any other peer
+// are ignored, since a client could otherwise claim any address.
+func ProxyHeaders(store *config.Store, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trusted := store.Get().Config.TrustedProxies
+		if len(trusted) == 0 || !containsIP(trusted, remoteIP(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r = r.Clone(r.Context())
+		if client := forwardedClient(trusted, r.Header.Values("X-Forwarded-For")); client != "" {
+			r.RemoteAddr = client
+		}
+		if host := firstValue(r.Header.Get("X-Forwarded-Host")); host != "" {
+			r.Host = host
+		}
+		if proto := strings.ToLower(firstValue(r.Header.Get("X-Forwarded-Proto"))); proto == "http" || proto == "https" {
+			r.URL.Scheme = proto
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// BasePath serves the application under HTTP_BASE_PATH by stripping the
+// prefix before routing. The bare prefix redirects to the dashboard and any
+// path outside the prefix is not found.
+func BasePath(store *config.Store, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := store.Get().Config.HTTPBasePath
+		if prefix == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.URL.Path == prefix {
+			http.Redirect(w, r, prefix+"/", http.StatusMovedPermanently)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, prefix+"/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		r = r.Clone(context.WithValue(r.Context(), basePathKey, prefix))
+		r.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
+		r.URL.RawPath = ""
+		next.ServeHTTP(w, r)
+	})
+}
+
+// basePathFor returns the base path the request was served under
+func basePathFor(r *http.Request) string {
+	prefix, _ := r.Context().Value(basePathKey).(string)
+	return prefix
+}
+
+// forwardedClient returns the client address from X-Forwarded-For values.
+// Each proxy appends the peer it saw, so the list is walked from the right
+// and the first address that is not a trusted proxy is the client. When
+// every entry is trusted the leftmost one is used.
+func forwardedClient(trusted []*net.IPNet, values []string) string {
+	var hops []string
+	for _, value := range values {
+		for _, hop := range strings.Split(value, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if ip == nil {
+			// Anything left of a malformed entry cannot be trusted
+			return ""
+		}
+		if !containsIP(trusted, ip) || i == 0 {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+// remoteIP returns the IP of the request's peer, nil for unix sockets
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// containsIP reports whether ip is in any of the networks
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstValue returns the first entry of a comma-separated header value
+func firstValue(value string) string {
+	if i := strings.IndexByte(value, ','); i >= 0 {
+		value = value[:i]
+	}
+	return strings.TrimSpace(value)
+}
@@ -0,0 +1,46 @@
+package web
+
+import (
+	"net"
+	"testing"
+)
+
+func TestForwardedClient(t *testing.T) {
+	trusted := []*net.IPNet{
+		mustParseCIDR(t, "10.0.0.0/8"),
+		mustParseCIDR(t, "192.168.1.1/32"),
+	}
+
+	tests := []struct {
+		name   string
+		values []string
+		want   string
+	}{
+		{"no header", nil, ""},
+		{"single client", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"rightmost untrusted wins", []string{"198.51.100.1, 203.0.113.7, 10.0.0.2"}, "203.0.113.7"},
+		{"spoofed left entries ignored", []string{"1.2.3.4, 203.0.113.7"}, "203.0.113.7"},
+		{"several headers", []string{"203.0.113.7", "10.0.0.2, 192.168.1.1"}, "203.0.113.7"},
+		{"all trusted uses leftmost", []string{"10.0.0.5, 10.0.0.2"}, "10.0.0.5"},
+		{"malformed hop", []string{"203.0.113.7, bogus, 10.0.0.2"}, ""},
+		{"empty hops skipped", []string{" , 203.0.113.7 ,"}, "203.0.113.7"},
+		{"ipv6 normalized", []string{"2001:DB8::1"}, "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := forwardedClient(trusted, tt.values); got != tt.want {
+				t.Errorf("forwardedClient(%q) = %q, want %q", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func mustParseCIDR(t *testing.T, cidr string) *net.IPNet {
+	t.Helper()
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return network
+}
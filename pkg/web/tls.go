@@ -0,0 +1,98 @@
+package web
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jpkribs/jellyfin-discovery-proxy/pkg/types"
+)
+
+// certCheckInterval limits how often the certificate files are checked for
+// changes, so a busy server does not stat them on every handshake
+const certCheckInterval = 10 * time.Second
+
+// CertReloader serves a certificate loaded from a cert/key file pair and
+// reloads it when either file changes, so renewed certificates (e.g. from
+// certbot) are picked up without a restart. A pair that fails to load is
+// logged and the previous certificate stays in use.
+type CertReloader struct {
+	certFile  string
+	keyFile   string
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+	mutex     sync.Mutex
+}
+
+// NewCertReloader loads the certificate pair, failing when it is invalid
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (r *CertReloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if time.Since(r.checkedAt) >= certCheckInterval {
+		r.checkedAt = time.Now()
+		modTime, err := r.latestModTime()
+		if err != nil {
+			logger.Logf(types.LogWarn, "Keeping current TLS certificate: %v", err)
+		} else if !modTime.Equal(r.modTime) {
+			if err := r.load(modTime); err != nil {
+				logger.Logf(types.LogWarn, "Keeping current TLS certificate: %v", err)
+			} else {
+				logger.Logf(types.LogInfo, "Reloaded TLS certificate from %s", r.certFile)
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+// TLSConfig returns a server TLS configuration using this reloader
+func (r *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+// load reads the certificate pair; the caller must hold the mutex unless
+// the reloader is still being constructed
+func (r *CertReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate '%s' and key '%s': %v", r.certFile, r.keyFile, err)
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	r.checkedAt = time.Now()
+	return nil
+}
+
+// latestModTime returns the later modification time of the two files
+func (r *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to read TLS file: %v", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}